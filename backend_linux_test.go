@@ -0,0 +1,167 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/takama/daemon"
+	"github.com/takama/daemon/daemontest"
+)
+
+// Name of the tested service, it is not found in PATH, so the test binary
+// is installed as the service executable
+const testService = "daemon-test-service"
+
+// Files which identify the init systems of the fake hosts
+var (
+	systemDHost  = []string{"/run/systemd/system", "/sbin/initctl", "service", "/etc/init.d"}
+	upstartHost  = []string{"/sbin/initctl", "service", "/etc/init.d"}
+	systemVHost  = []string{"service", "/etc/init.d"}
+	rootIdentity = daemon.FakeHost{UID: 0}
+)
+
+// Error of the failed command
+var errCommand = errors.New("command failed")
+
+// backendTest - operation of the service and its expected effects, the
+// "$ROOT" and "$EXEC" words of the expectations are replaced by the
+// alternate root and the path of the service executable
+type backendTest struct {
+	name string
+
+	// options of the service in addition to the runner and the root
+	options []daemon.Option
+
+	// the service is installed before the operation
+	installed bool
+
+	// results and errors of the commands by their prefixes
+	results map[string]string
+	errors  map[string]error
+
+	run func(service daemon.Daemon) error
+
+	// commands - expected command lines run by the operation
+	commands []string
+
+	// files - expected fragments of the files, "-> target" for the symlinks
+	files map[string]string
+
+	// absent - files which must not exist after the operation
+	absent []string
+
+	err error
+}
+
+// Run the table of the backend tests on the fake host with the files
+func runBackendTests(t *testing.T, hostFiles []string, tests []backendTest) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			expand := strings.NewReplacer("$ROOT", root, "$EXEC", executable).Replace
+
+			runner := &daemontest.Runner{}
+			for command, output := range test.results {
+				runner.On(expand(command), output, nil)
+			}
+			for command, err := range test.errors {
+				runner.On(expand(command), "", err)
+			}
+
+			host := rootIdentity
+			host.Files = hostFiles
+			options := append([]daemon.Option{
+				daemon.WithRunner(runner),
+				daemon.WithRoot(root),
+				daemon.WithHost(&host),
+			}, test.options...)
+
+			service, err := daemon.NewWithOptions(testService, "Test service", daemon.SystemDaemon, options...)
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+
+			if test.installed {
+				if _, err := service.Install("-v"); err != nil {
+					t.Fatalf("Install() error = %v", err)
+				}
+				runner.Reset()
+			}
+
+			err = test.run(service)
+			if test.err == nil && err != nil || test.err != nil && !errors.Is(err, test.err) {
+				t.Fatalf("error = %v; want %v", err, test.err)
+			}
+
+			var commands []string
+			for _, command := range test.commands {
+				commands = append(commands, expand(command))
+			}
+			if lines := runner.CommandLines(); !reflect.DeepEqual(lines, commands) {
+				t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(commands, "\n"))
+			}
+
+			for name, want := range test.files {
+				path := filepath.Join(root, name)
+				if strings.HasPrefix(want, "-> ") {
+					target, err := os.Readlink(path)
+					if err != nil {
+						t.Errorf("%s: %v", name, err)
+					} else if target != expand(strings.TrimPrefix(want, "-> ")) {
+						t.Errorf("%s -> %s; want %s", name, target, want)
+					}
+					continue
+				}
+
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+				} else if !strings.Contains(string(data), expand(want)) {
+					t.Errorf("%s:\n%s\nwant to contain:\n%s", name, data, expand(want))
+				}
+			}
+
+			for _, name := range test.absent {
+				if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+					t.Errorf("%s exists; want absent (%v)", name, err)
+				}
+			}
+		})
+	}
+}
+
+// Operations of the service which ignore the message
+func install(service daemon.Daemon) error { _, err := service.Install("-v"); return err }
+func remove(service daemon.Daemon) error  { _, err := service.Remove(); return err }
+func start(service daemon.Daemon) error   { _, err := service.Start(); return err }
+func stop(service daemon.Daemon) error    { _, err := service.Stop(); return err }
+func enable(service daemon.Daemon) error  { _, err := service.Enable(); return err }
+func disable(service daemon.Daemon) error { _, err := service.Disable(); return err }
+
+// Status operation which expects the state and pid of the service
+func status(state daemon.State, pid int) func(service daemon.Daemon) error {
+	return func(service daemon.Daemon) error {
+		status, err := service.StatusInfo()
+		if err != nil {
+			return err
+		}
+		if status.State != state || status.PID != pid {
+			return errors.New("unexpected status " + status.String())
+		}
+		return nil
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"strings"
+)
+
+// Colorize - color the "OK" and "FAILED" marks of the status returned by
+// the operations of the service for the output to a terminal
+func Colorize(status string) string {
+	status = strings.Replace(status, "[  OK  ]", "[  \033[32mOK\033[0m  ]", -1)
+	return strings.Replace(status, "[FAILED]", "[\033[31mFAILED\033[0m]", -1)
+}
+
+// Is the colored output enabled for the file: the file is a terminal and
+// the colors are not disabled by NO_COLOR (https://no-color.org) or TERM
+func colorEnabled(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -18,12 +18,9 @@ Example:
 	package main
 
 	import (
-		"fmt"
 		"log"
 		"net"
 		"os"
-		"os/signal"
-		"syscall"
 
 		"github.com/takama/daemon"
 	)
@@ -38,91 +35,60 @@ Example:
 		port = ":9977"
 	)
 
-  // dependencies that are NOT required by the service, but might be used
-  var dependencies = []string{"dummy.service"}
+	// dependencies that are NOT required by the service, but might be used
+	var dependencies = []string{"dummy.service"}
 
 	var stdlog, errlog *log.Logger
 
-	// Service has embedded daemon
+	// Service is the echo service executed by the daemon
 	type Service struct {
-		daemon.Daemon
+		listener net.Listener
+		done     chan struct{}
 	}
 
-	// Manage by daemon commands or run the daemon
-	func (service *Service) Manage() (string, error) {
-
-		usage := "Usage: myservice install | remove | start | stop | status"
-
-		// if received any kind of command, do it
-		if len(os.Args) > 1 {
-			command := os.Args[1]
-			switch command {
-			case "install":
-				return service.Install()
-			case "remove":
-				return service.Remove()
-			case "start":
-				return service.Start()
-			case "stop":
-				return service.Stop()
-			case "status":
-				return service.Status()
-			default:
-				return usage, nil
-			}
-		}
-
-		// Do something, call your goroutines, etc
-
-		// Set up channel on which to send signal notifications.
-		// We must use a buffered channel or risk missing the signal
-		// if we're not ready to receive when the signal is sent.
-		interrupt := make(chan os.Signal, 1)
-		signal.Notify(interrupt, os.Interrupt, os.Kill, syscall.SIGTERM)
-
-		// Set up listener for defined host and port
-		listener, err := net.Listen("tcp", port)
+	// Start listening and serving clients
+	func (service *Service) Start() {
+		// Set up listener for defined host and port, or take the socket
+		// passed by systemd socket activation
+		listener, err := daemon.Listen(name, port)
 		if err != nil {
-			return "Possibly was a problem with the port binding", err
+			errlog.Println("Possibly was a problem with the port binding", err)
+			os.Exit(1)
 		}
+		service.listener = listener
+		service.done = make(chan struct{})
 
-		// set up channel on which to send accepted connections
-		listen := make(chan net.Conn, 100)
-		go acceptConnection(listener, listen)
+		go acceptConnection(listener, service.done)
+	}
 
-		// loop work cycle with accept connections or interrupt
-		// by system signal
-		for {
-			select {
-			case conn := <-listen:
-				go handleClient(conn)
-			case killSignal := <-interrupt:
-				stdlog.Println("Got signal:", killSignal)
-				stdlog.Println("Stoping listening on ", listener.Addr())
-				listener.Close()
-				if killSignal == os.Interrupt {
-					return "Daemon was interrupted by system signal", nil
-				}
-				return "Daemon was killed", nil
-			}
-		}
+	// Stop listening, the daemon calls it on SIGTERM or SIGINT
+	func (service *Service) Stop() {
+		stdlog.Println("Stoping listening on ", service.listener.Addr())
+		service.listener.Close()
+		<-service.done
+	}
 
-		// never happen, but need to complete code
-		return usage, nil
+	// Run serving clients until the listener is closed, the daemon calls it in
+	// an interactive session on Windows only
+	func (service *Service) Run() {
+		service.Start()
+		<-service.done
 	}
 
-	// Accept a client connection and collect it in a channel
-	func acceptConnection(listener net.Listener, listen chan<- net.Conn) {
+	// Accept client connections and serve them until the listener is closed
+	func acceptConnection(listener net.Listener, done chan<- struct{}) {
+		defer close(done)
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
-				continue
+				return
 			}
-			listen <- conn
+			go handleClient(conn)
 		}
 	}
 
 	func handleClient(client net.Conn) {
+		defer client.Close()
 		for {
 			buf := make([]byte, 4096)
 			numbytes, err := client.Read(buf)
@@ -134,8 +100,8 @@ Example:
 	}
 
 	func init() {
-		stdlog = log.New(os.Stdout, "", log.Ldate|log.Ltime)
-		errlog = log.New(os.Stderr, "", log.Ldate|log.Ltime)
+		stdlog = log.New(os.Stdout, "", 0)
+		errlog = log.New(os.Stderr, "", 0)
 	}
 
 	func main() {
@@ -144,13 +110,8 @@ Example:
 			errlog.Println("Error: ", err)
 			os.Exit(1)
 		}
-		service := &Service{srv}
-		status, err := service.Manage()
-		if err != nil {
-			errlog.Println(status, "\nError: ", err)
-			os.Exit(1)
-		}
-		fmt.Println(status)
+		// Manage by daemon commands or run the daemon
+		os.Exit(daemon.Manage(srv, &Service{}, os.Args[1:]))
 	}
 
 Go daemon
@@ -158,7 +119,9 @@ Go daemon
 package daemon
 
 import (
+	"context"
 	"errors"
+	"io"
 	"runtime"
 	"strings"
 )
@@ -188,23 +151,73 @@ type Daemon interface {
 	// Stop the service
 	Stop() (string, error)
 
+	// Restart the service, it is started if it is not running
+	Restart() (string, error)
+
+	// Reload - ask the running service to reload its configuration
+	Reload() (string, error)
+
+	// Enable - start the service automatically when the system boots
+	Enable() (string, error)
+
+	// Disable - do not start the service automatically when the system boots
+	Disable() (string, error)
+
 	// Status - check the service status
 	Status() (string, error)
 
-	// Run - run executable service
+	// StatusInfo - check the service status in a structured form
+	StatusInfo() (ServiceStatus, error)
+
+	// Watch - watch the service status, the transitions of the service state
+	// are sent to the channel, which is closed when the context is done
+	Watch(ctx context.Context) (<-chan StatusEvent, error)
+
+	// Logs - read the service log, the reader should be closed to stop
+	// following of the log
+	Logs(opts LogOptions) (io.ReadCloser, error)
+
+	// Run - run executable service: start it, wait for a termination signal
+	// (SIGTERM, SIGINT or stop request of the windows service manager), or
+	// for the end of its work if it implements Finisher, and stop it
 	Run(e Executable) (string, error)
+
+	// RunContext - run context-aware executable service the same way as Run,
+	// the error of the executable is returned, so the process should exit
+	// with non-zero code to let the service manager restart the service
+	RunContext(e ExecutableContext) (string, error)
 }
 
-// Executable interface defines controlling methods of executable service
+// Executable interface defines controlling methods of executable service,
+// it may also implement Reloader to reload its configuration on SIGHUP and
+// Finisher to let Run return when its work is finished.
+//
+// Run of the service calls Start, waits for a termination signal (or the stop
+// request of the windows service manager) and calls Stop. Run of the
+// executable is called only in an interactive session on Windows: unlike the
+// former versions, Run of the service does not call it on Linux, FreeBSD and
+// macOS, so it must not be the only place where the service does its work.
 type Executable interface {
 	// Start - non-blocking start service
 	Start()
-	// Stop - non-blocking stop service
+	// Stop - stop service, Run returns when it returns
 	Stop()
-	// Run - blocking run service
+	// Run - blocking run service in an interactive session on Windows
 	Run()
 }
 
+// ExecutableContext interface defines controlling methods of context-aware
+// executable service, it may also implement ReloaderContext to reload its
+// configuration on SIGHUP
+type ExecutableContext interface {
+	// Start - start service, the context is cancelled when the service
+	// receives a termination signal
+	Start(ctx context.Context) error
+	// Stop - stop service, the context is cancelled when the stop timeout
+	// expires
+	Stop(ctx context.Context) error
+}
+
 // Kind is type of the daemon
 type Kind string
 
@@ -229,6 +242,11 @@ const (
 	// system-wide daemons provided by the administrator. Valid for FreeBSD, Linux
 	// and Windows only.
 	SystemDaemon Kind = "SystemDaemon"
+
+	// UserService is a user daemon that runs as the current user and stores its
+	// unit file in the user's systemd configuration directory. It is managed by
+	// "systemctl --user" without root privileges. Valid for Linux systemd only.
+	UserService Kind = "UserService"
 )
 
 // New - Create a new daemon
@@ -239,9 +257,20 @@ const (
 //
 // kind: what kind of daemon to create
 func New(name, description string, kind Kind, dependencies ...string) (Daemon, error) {
+	return NewWithOptions(name, description, kind, WithDependencies(dependencies...))
+}
+
+// NewWithOptions - Create a new daemon with optional properties of the service
+//
+//	daemon.NewWithOptions(name, description, daemon.SystemDaemon,
+//		daemon.WithUser("svc"),
+//		daemon.WithWorkDir("/var/lib/svc"),
+//		daemon.WithEnv("PORT=9977"),
+//	)
+func NewWithOptions(name, description string, kind Kind, options ...Option) (Daemon, error) {
 	switch runtime.GOOS {
 	case "darwin":
-		if kind == SystemDaemon {
+		if kind == SystemDaemon || kind == UserService {
 			return nil, errors.New("Invalid daemon kind specified")
 		}
 	case "freebsd":
@@ -249,7 +278,7 @@ func New(name, description string, kind Kind, dependencies ...string) (Daemon, e
 			return nil, errors.New("Invalid daemon kind specified")
 		}
 	case "linux":
-		if kind != SystemDaemon {
+		if kind != SystemDaemon && kind != UserService {
 			return nil, errors.New("Invalid daemon kind specified")
 		}
 	case "windows":
@@ -258,5 +287,26 @@ func New(name, description string, kind Kind, dependencies ...string) (Daemon, e
 		}
 	}
 
-	return newDaemon(strings.Join(strings.Fields(name), "_"), description, kind, dependencies)
+	var cfg config
+	for _, option := range options {
+		option(&cfg)
+	}
+	name = strings.Join(strings.Fields(name), "_")
+	if err := cfg.validate(name, description, kind); err != nil {
+		return nil, err
+	}
+	if cfg.runner == nil {
+		cfg.runner = execRunner{}
+	}
+	if cfg.dbus {
+		// the stop job is given the stop timeout of the executable and the
+		// time to deliver the signal
+		timeout := cfg.stopTimeout
+		if timeout <= 0 {
+			timeout = defaultStopTimeout
+		}
+		cfg.runner = newDBusRunner(cfg.dbusAddress, timeout+defaultStopTimeout/2, cfg.runner)
+	}
+
+	return newDaemon(name, description, kind, cfg)
 }
@@ -6,25 +6,28 @@
 package daemon
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"text/template"
 )
 
 // darwinRecord - standard record (struct) for darwin version of daemon package
 type darwinRecord struct {
-	name         string
-	description  string
-	kind         Kind
-	dependencies []string
+	name        string
+	description string
+	kind        Kind
+	config      config
 }
 
-func newDaemon(name, description string, kind Kind, dependencies []string) (Daemon, error) {
+func newDaemon(name, description string, kind Kind, cfg config) (Daemon, error) {
 
-	return &darwinRecord{name, description, kind, dependencies}, nil
+	return &darwinRecord{name, description, kind, cfg}, nil
 }
 
 // Standard service path for system daemons
@@ -41,7 +44,12 @@ func (darwin *darwinRecord) servicePath() string {
 		path = "/Library/LaunchDaemons/" + darwin.name + ".plist"
 	}
 
-	return path
+	return darwin.config.path(path)
+}
+
+// Error of the failed operation of the service
+func (darwin *darwinRecord) operationError(op string, err error) error {
+	return newOperationError(op, "launchd", darwin.name, err)
 }
 
 // Is a service installed
@@ -59,106 +67,152 @@ func execPath() (string, error) {
 	return filepath.Abs(os.Args[0])
 }
 
-// Check service is running
-func (darwin *darwinRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("launchctl", "list", darwin.name).Output()
+// Get status of the service from "launchctl list <name>" output
+func (darwin *darwinRecord) status() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "launchd"}
+
+	output, err := darwin.config.runner.Run("launchctl", "list", darwin.name)
 	if err == nil {
 		if matched, err := regexp.MatchString(darwin.name, string(output)); err == nil && matched {
+			status.State = StateRunning
 			reg := regexp.MustCompile("PID\" = ([0-9]+);")
 			data := reg.FindStringSubmatch(string(output))
 			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
+				status.PID, _ = strconv.Atoi(data[1])
+			}
+			reg = regexp.MustCompile("LastExitStatus\" = ([0-9]+);")
+			data = reg.FindStringSubmatch(string(output))
+			if len(data) > 1 {
+				status.ExitCode, _ = strconv.Atoi(data[1])
 			}
-			return "Service is running...", true
 		}
 	}
 
-	return "Service is stopped", false
+	return status
+}
+
+// Is the elevation of the privileges enabled
+func (darwin *darwinRecord) elevation() bool {
+	return darwin.config.elevate
+}
+
+// Check service is running
+func (darwin *darwinRecord) checkRunning() (string, bool) {
+	status := darwin.status()
+	return status.String(), status.State == StateRunning
 }
 
 // Install the service
 func (darwin *darwinRecord) Install(args ...string) (string, error) {
 	installAction := "Install " + darwin.description + ":"
 
-	ok, err := checkPrivileges()
+	ok, err := darwin.config.checkFilePrivileges()
 	if !ok && darwin.kind != UserAgent {
-		return installAction + failed, err
+		return installAction + failed, darwin.operationError("install", err)
 	}
 
-	srvPath := darwin.servicePath()
+	plan, err := darwin.PlanInstall(args...)
+	if err != nil {
+		return installAction + failed, darwin.operationError("install", err)
+	}
 
-	if darwin.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+	if err := plan.apply(&darwin.config); err != nil {
+		return installAction + failed, darwin.operationError("install", err)
 	}
 
-	file, err := os.Create(srvPath)
-	if err != nil {
-		return installAction + failed, err
+	return installAction + success, nil
+}
+
+// PlanInstall - get the changes made by Install
+func (darwin *darwinRecord) PlanInstall(args ...string) (Plan, error) {
+	var plan Plan
+
+	if darwin.isInstalled() {
+		return plan, ErrAlreadyInstalled
 	}
-	defer file.Close()
 
 	execPatch, err := executablePath(darwin.name)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
 	templ, err := template.New("propertyList").Parse(propertyList)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
+	var content bytes.Buffer
 	if err := templ.Execute(
-		file,
+		&content,
 		&struct {
 			Name, Path string
 			Args       []string
 		}{darwin.name, execPatch, args},
 	); err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
-	return installAction + success, nil
+	plan.add(
+		writeFileStep(darwin.servicePath(), content.String(), 0644),
+		removeStep(darwin.servicePath(), true),
+	)
+
+	return plan, nil
 }
 
 // Remove the service
 func (darwin *darwinRecord) Remove() (string, error) {
 	removeAction := "Removing " + darwin.description + ":"
 
-	ok, err := checkPrivileges()
+	ok, err := darwin.config.checkFilePrivileges()
 	if !ok && darwin.kind != UserAgent {
-		return removeAction + failed, err
+		return removeAction + failed, darwin.operationError("remove", err)
 	}
 
-	if !darwin.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+	plan, err := darwin.PlanRemove()
+	if err != nil {
+		return removeAction + failed, darwin.operationError("remove", err)
 	}
 
-	if err := os.Remove(darwin.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := plan.apply(&darwin.config); err != nil {
+		return removeAction + failed, darwin.operationError("remove", err)
 	}
 
 	return removeAction + success, nil
 }
 
+// PlanRemove - get the changes made by Remove
+func (darwin *darwinRecord) PlanRemove() (Plan, error) {
+	var plan Plan
+
+	if !darwin.isInstalled() {
+		return plan, ErrNotInstalled
+	}
+
+	plan.add(removeStep(darwin.servicePath(), false))
+
+	return plan, nil
+}
+
 // Start the service
 func (darwin *darwinRecord) Start() (string, error) {
 	startAction := "Starting " + darwin.description + ":"
 
-	ok, err := checkPrivileges()
+	ok, err := darwin.config.checkPrivileges()
 	if !ok && darwin.kind != UserAgent {
-		return startAction + failed, err
+		return startAction + failed, darwin.operationError("start", err)
 	}
 
 	if !darwin.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return startAction + failed, darwin.operationError("start", ErrNotInstalled)
 	}
 
 	if _, ok := darwin.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return startAction + failed, darwin.operationError("start", ErrAlreadyRunning)
 	}
 
-	if err := exec.Command("launchctl", "load", darwin.servicePath()).Run(); err != nil {
-		return startAction + failed, err
+	if _, err := darwin.config.runner.Run("launchctl", "load", darwin.servicePath()); err != nil {
+		return startAction + failed, darwin.operationError("start", err)
 	}
 
 	return startAction + success, nil
@@ -168,47 +222,166 @@ func (darwin *darwinRecord) Start() (string, error) {
 func (darwin *darwinRecord) Stop() (string, error) {
 	stopAction := "Stopping " + darwin.description + ":"
 
-	ok, err := checkPrivileges()
+	ok, err := darwin.config.checkPrivileges()
 	if !ok && darwin.kind != UserAgent {
-		return stopAction + failed, err
+		return stopAction + failed, darwin.operationError("stop", err)
 	}
 
 	if !darwin.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return stopAction + failed, darwin.operationError("stop", ErrNotInstalled)
 	}
 
 	if _, ok := darwin.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return stopAction + failed, darwin.operationError("stop", ErrAlreadyStopped)
 	}
 
-	if err := exec.Command("launchctl", "unload", darwin.servicePath()).Run(); err != nil {
-		return stopAction + failed, err
+	if _, err := darwin.config.runner.Run("launchctl", "unload", darwin.servicePath()); err != nil {
+		return stopAction + failed, darwin.operationError("stop", err)
 	}
 
 	return stopAction + success, nil
 }
 
+// Restart the service
+func (darwin *darwinRecord) Restart() (string, error) {
+	restartAction := "Restarting " + darwin.description + ":"
+
+	ok, err := darwin.config.checkPrivileges()
+	if !ok && darwin.kind != UserAgent {
+		return restartAction + failed, darwin.operationError("restart", err)
+	}
+
+	if !darwin.isInstalled() {
+		return restartAction + failed, darwin.operationError("restart", ErrNotInstalled)
+	}
+
+	if _, ok := darwin.checkRunning(); ok {
+		if _, err := darwin.config.runner.Run("launchctl", "unload", darwin.servicePath()); err != nil {
+			return restartAction + failed, darwin.operationError("restart", err)
+		}
+	}
+
+	if _, err := darwin.config.runner.Run("launchctl", "load", darwin.servicePath()); err != nil {
+		return restartAction + failed, darwin.operationError("restart", err)
+	}
+
+	return restartAction + success, nil
+}
+
+// Reload the service configuration, it is not supported by launchd
+func (darwin *darwinRecord) Reload() (string, error) {
+	return "Reloading " + darwin.description + ":" + failed, darwin.operationError("reload", ErrUnsupported)
+}
+
+// Service target of launchctl in the domain of the service
+func (darwin *darwinRecord) serviceTarget() string {
+	if darwin.kind == GlobalDaemon {
+		return "system/" + darwin.name
+	}
+	return "gui/" + strconv.Itoa(os.Getuid()) + "/" + darwin.name
+}
+
+// Enable the service
+func (darwin *darwinRecord) Enable() (string, error) {
+	enableAction := "Enabling " + darwin.description + ":"
+
+	ok, err := darwin.config.checkPrivileges()
+	if !ok && darwin.kind != UserAgent {
+		return enableAction + failed, darwin.operationError("enable", err)
+	}
+
+	if !darwin.isInstalled() {
+		return enableAction + failed, darwin.operationError("enable", ErrNotInstalled)
+	}
+
+	if _, err := darwin.config.runner.Run("launchctl", "enable", darwin.serviceTarget()); err != nil {
+		return enableAction + failed, darwin.operationError("enable", err)
+	}
+
+	return enableAction + success, nil
+}
+
+// Disable the service
+func (darwin *darwinRecord) Disable() (string, error) {
+	disableAction := "Disabling " + darwin.description + ":"
+
+	ok, err := darwin.config.checkPrivileges()
+	if !ok && darwin.kind != UserAgent {
+		return disableAction + failed, darwin.operationError("disable", err)
+	}
+
+	if !darwin.isInstalled() {
+		return disableAction + failed, darwin.operationError("disable", ErrNotInstalled)
+	}
+
+	if _, err := darwin.config.runner.Run("launchctl", "disable", darwin.serviceTarget()); err != nil {
+		return disableAction + failed, darwin.operationError("disable", err)
+	}
+
+	return disableAction + success, nil
+}
+
 // Status - Get service status
 func (darwin *darwinRecord) Status() (string, error) {
+	status, err := formatStatus(darwin.StatusInfo())
+	return status, darwin.operationError("status", err)
+}
+
+// StatusInfo - Get structured service status
+func (darwin *darwinRecord) StatusInfo() (ServiceStatus, error) {
 
-	ok, err := checkPrivileges()
+	ok, err := darwin.config.checkPrivileges()
 	if !ok && darwin.kind != UserAgent {
-		return "", err
+		return ServiceStatus{}, darwin.operationError("status", err)
 	}
 
 	if !darwin.isInstalled() {
-		return statNotInstalled, ErrNotInstalled
+		return ServiceStatus{State: StateNotInstalled, Backend: "launchd"}, nil
+	}
+
+	return darwin.status(), nil
+}
+
+// Watch - Watch the service status
+func (darwin *darwinRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if _, err := darwin.StatusInfo(); err != nil {
+		return nil, err
 	}
 
-	statusAction, _ := darwin.checkRunning()
+	return watchStatus(ctx, func() ServiceStatus {
+		status, _ := darwin.StatusInfo()
+		return status
+	}, nil), nil
+}
+
+// Logs - Read the service log from the log files
+func (darwin *darwinRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	if !darwin.isInstalled() {
+		return nil, darwin.operationError("logs", ErrNotInstalled)
+	}
 
-	return statusAction, nil
+	reader, err := fileLogs([]string{
+		darwin.config.path("/usr/local/var/log/" + darwin.name + ".log"),
+		darwin.config.path("/usr/local/var/log/" + darwin.name + ".err"),
+	}, opts)
+	if err != nil {
+		return nil, darwin.operationError("logs", err)
+	}
+	return reader, nil
 }
 
 // Run - Run service
 func (darwin *darwinRecord) Run(e Executable) (string, error) {
+	return darwin.RunContext(&executableAdapter{e})
+}
+
+// RunContext - Run context-aware service
+func (darwin *darwinRecord) RunContext(e ExecutableContext) (string, error) {
 	runAction := "Running " + darwin.description + ":"
-	e.Run()
+
+	if err := darwin.config.run(darwin.name, darwin.description, darwin.kind, e); err != nil {
+		return runAction + failed, darwin.operationError("run", err)
+	}
 	return runAction + " completed.", nil
 }
 
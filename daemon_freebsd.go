@@ -5,27 +5,35 @@
 package daemon
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 )
 
 // systemVRecord - standard record (struct) for linux systemV version of daemon package
 type bsdRecord struct {
-	name         string
-	description  string
-	kind         Kind
-	dependencies []string
+	name        string
+	description string
+	kind        Kind
+	config      config
 }
 
 // Standard service path for systemV daemons
 func (bsd *bsdRecord) servicePath() string {
-	return "/usr/local/etc/rc.d/" + bsd.name
+	return bsd.config.path("/usr/local/etc/rc.d/" + bsd.name)
+}
+
+// Error of the failed operation of the service
+func (bsd *bsdRecord) operationError(op string, err error) error {
+	return newOperationError(op, "rc.d", bsd.name, err)
 }
 
 // Is a service installed
@@ -40,9 +48,8 @@ func (bsd *bsdRecord) isInstalled() bool {
 
 // Is a service is enabled
 func (bsd *bsdRecord) isEnabled() (bool, error) {
-	rcConf, err := os.Open("/etc/rc.conf")
+	rcConf, err := os.Open(bsd.config.path("/etc/rc.conf"))
 	if err != nil {
-		fmt.Println("Error opening file:", err)
 		return false, err
 	}
 	defer rcConf.Close()
@@ -62,17 +69,26 @@ func (bsd *bsdRecord) isEnabled() (bool, error) {
 	return chrFound, nil
 }
 
+// Arguments of sysrc to set the variable, the alternate root directory
+// is passed to sysrc
+func (bsd *bsdRecord) sysrcArgs(variable string) []string {
+	if bsd.config.root != "" {
+		return []string{"-R", bsd.config.root, variable}
+	}
+	return []string{variable}
+}
+
 func (bsd *bsdRecord) getCmd(cmd string) string {
+	// the commands of the disabled services are prefixed by "one"
 	if ok, err := bsd.isEnabled(); !ok || err != nil {
-		fmt.Println("Service is not enabled, using one" + cmd + " instead")
 		cmd = "one" + cmd
 	}
 	return cmd
 }
 
 // Get the daemon properly
-func newDaemon(name, description string, kind Kind, dependencies []string) (Daemon, error) {
-	return &bsdRecord{name, description, kind, dependencies}, nil
+func newDaemon(name, description string, kind Kind, cfg config) (Daemon, error) {
+	return &bsdRecord{name, description, kind, cfg}, nil
 }
 
 func execPath() (name string, err error) {
@@ -88,106 +104,143 @@ func execPath() (name string, err error) {
 	return name, err
 }
 
-// Check service is running
-func (bsd *bsdRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("service", bsd.name, bsd.getCmd("status")).Output()
+// Get status of the service from "service <name> status" output
+func (bsd *bsdRecord) status() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "rc.d"}
+
+	output, err := bsd.config.runner.Run("service", bsd.name, bsd.getCmd("status"))
 	if err == nil {
 		if matched, err := regexp.MatchString(bsd.name, string(output)); err == nil && matched {
+			status.State = StateRunning
 			reg := regexp.MustCompile("pid  ([0-9]+)")
 			data := reg.FindStringSubmatch(string(output))
 			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
+				status.PID, _ = strconv.Atoi(data[1])
 			}
-			return "Service is running...", true
 		}
 	}
 
-	return "Service is stopped", false
+	return status
+}
+
+// Is the elevation of the privileges enabled
+func (bsd *bsdRecord) elevation() bool {
+	return bsd.config.elevate
+}
+
+// Check service is running
+func (bsd *bsdRecord) checkRunning() (string, bool) {
+	status := bsd.status()
+	return status.String(), status.State == StateRunning
 }
 
 // Install the service
 func (bsd *bsdRecord) Install(args ...string) (string, error) {
 	installAction := "Install " + bsd.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+	if ok, err := bsd.config.checkFilePrivileges(); !ok {
+		return installAction + failed, bsd.operationError("install", err)
 	}
 
-	srvPath := bsd.servicePath()
+	plan, err := bsd.PlanInstall(args...)
+	if err != nil {
+		return installAction + failed, bsd.operationError("install", err)
+	}
 
-	if bsd.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+	if err := plan.apply(&bsd.config); err != nil {
+		return installAction + failed, bsd.operationError("install", err)
 	}
 
-	file, err := os.Create(srvPath)
-	if err != nil {
-		return installAction + failed, err
+	return installAction + success, nil
+}
+
+// PlanInstall - get the changes made by Install
+func (bsd *bsdRecord) PlanInstall(args ...string) (Plan, error) {
+	var plan Plan
+
+	if bsd.isInstalled() {
+		return plan, ErrAlreadyInstalled
 	}
-	defer file.Close()
 
 	execPatch, err := executablePath(bsd.name)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
 	templ, err := template.New("bsdConfig").Parse(bsdConfig)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
+	var content bytes.Buffer
 	if err := templ.Execute(
-		file,
+		&content,
 		&struct {
 			Name, Description, Path, Args string
 		}{bsd.name, bsd.description, execPatch, strings.Join(args, " ")},
 	); err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
-	if err := os.Chmod(srvPath, 0755); err != nil {
-		return installAction + failed, err
-	}
+	plan.add(
+		writeFileStep(bsd.servicePath(), content.String(), 0755),
+		removeStep(bsd.servicePath(), true),
+	)
 
-	return installAction + success, nil
+	return plan, nil
 }
 
 // Remove the service
 func (bsd *bsdRecord) Remove() (string, error) {
 	removeAction := "Removing " + bsd.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+	if ok, err := bsd.config.checkFilePrivileges(); !ok {
+		return removeAction + failed, bsd.operationError("remove", err)
 	}
 
-	if !bsd.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+	plan, err := bsd.PlanRemove()
+	if err != nil {
+		return removeAction + failed, bsd.operationError("remove", err)
 	}
 
-	if err := os.Remove(bsd.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := plan.apply(&bsd.config); err != nil {
+		return removeAction + failed, bsd.operationError("remove", err)
 	}
 
 	return removeAction + success, nil
 }
 
+// PlanRemove - get the changes made by Remove
+func (bsd *bsdRecord) PlanRemove() (Plan, error) {
+	var plan Plan
+
+	if !bsd.isInstalled() {
+		return plan, ErrNotInstalled
+	}
+
+	plan.add(removeStep(bsd.servicePath(), false))
+
+	return plan, nil
+}
+
 // Start the service
 func (bsd *bsdRecord) Start() (string, error) {
 	startAction := "Starting " + bsd.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return startAction + failed, bsd.operationError("start", err)
 	}
 
 	if !bsd.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return startAction + failed, bsd.operationError("start", ErrNotInstalled)
 	}
 
 	if _, ok := bsd.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return startAction + failed, bsd.operationError("start", ErrAlreadyRunning)
 	}
 
-	if err := exec.Command("service", bsd.name, bsd.getCmd("start")).Run(); err != nil {
-		return startAction + failed, err
+	if _, err := bsd.config.runner.Run("service", bsd.name, bsd.getCmd("start")); err != nil {
+		return startAction + failed, bsd.operationError("start", err)
 	}
 
 	return startAction + success, nil
@@ -197,45 +250,155 @@ func (bsd *bsdRecord) Start() (string, error) {
 func (bsd *bsdRecord) Stop() (string, error) {
 	stopAction := "Stopping " + bsd.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return stopAction + failed, bsd.operationError("stop", err)
 	}
 
 	if !bsd.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return stopAction + failed, bsd.operationError("stop", ErrNotInstalled)
 	}
 
 	if _, ok := bsd.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return stopAction + failed, bsd.operationError("stop", ErrAlreadyStopped)
 	}
 
-	if err := exec.Command("service", bsd.name, bsd.getCmd("stop")).Run(); err != nil {
-		return stopAction + failed, err
+	if _, err := bsd.config.runner.Run("service", bsd.name, bsd.getCmd("stop")); err != nil {
+		return stopAction + failed, bsd.operationError("stop", err)
 	}
 
 	return stopAction + success, nil
 }
 
+// Restart the service
+func (bsd *bsdRecord) Restart() (string, error) {
+	restartAction := "Restarting " + bsd.description + ":"
+
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return restartAction + failed, bsd.operationError("restart", err)
+	}
+
+	if !bsd.isInstalled() {
+		return restartAction + failed, bsd.operationError("restart", ErrNotInstalled)
+	}
+
+	if _, err := bsd.config.runner.Run("service", bsd.name, bsd.getCmd("restart")); err != nil {
+		return restartAction + failed, bsd.operationError("restart", err)
+	}
+
+	return restartAction + success, nil
+}
+
+// Reload the service configuration
+func (bsd *bsdRecord) Reload() (string, error) {
+	reloadAction := "Reloading " + bsd.description + ":"
+
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return reloadAction + failed, bsd.operationError("reload", err)
+	}
+
+	if !bsd.isInstalled() {
+		return reloadAction + failed, bsd.operationError("reload", ErrNotInstalled)
+	}
+
+	if _, ok := bsd.checkRunning(); !ok {
+		return reloadAction + failed, bsd.operationError("reload", ErrAlreadyStopped)
+	}
+
+	if _, err := bsd.config.runner.Run("service", bsd.name, bsd.getCmd("reload")); err != nil {
+		return reloadAction + failed, bsd.operationError("reload", err)
+	}
+
+	return reloadAction + success, nil
+}
+
+// Enable the service
+func (bsd *bsdRecord) Enable() (string, error) {
+	enableAction := "Enabling " + bsd.description + ":"
+
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return enableAction + failed, bsd.operationError("enable", err)
+	}
+
+	if !bsd.isInstalled() {
+		return enableAction + failed, bsd.operationError("enable", ErrNotInstalled)
+	}
+
+	if _, err := bsd.config.runner.Run("sysrc", bsd.sysrcArgs(bsd.name+"_enable=YES")...); err != nil {
+		return enableAction + failed, bsd.operationError("enable", err)
+	}
+
+	return enableAction + success, nil
+}
+
+// Disable the service
+func (bsd *bsdRecord) Disable() (string, error) {
+	disableAction := "Disabling " + bsd.description + ":"
+
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return disableAction + failed, bsd.operationError("disable", err)
+	}
+
+	if !bsd.isInstalled() {
+		return disableAction + failed, bsd.operationError("disable", ErrNotInstalled)
+	}
+
+	if _, err := bsd.config.runner.Run("sysrc", bsd.sysrcArgs(bsd.name+"_enable=NO")...); err != nil {
+		return disableAction + failed, bsd.operationError("disable", err)
+	}
+
+	return disableAction + success, nil
+}
+
 // Status - Get service status
 func (bsd *bsdRecord) Status() (string, error) {
+	status, err := formatStatus(bsd.StatusInfo())
+	return status, bsd.operationError("status", err)
+}
+
+// StatusInfo - Get structured service status
+func (bsd *bsdRecord) StatusInfo() (ServiceStatus, error) {
 
-	if ok, err := checkPrivileges(); !ok {
-		return "", err
+	if ok, err := bsd.config.checkPrivileges(); !ok {
+		return ServiceStatus{}, bsd.operationError("status", err)
 	}
 
 	if !bsd.isInstalled() {
-		return statNotInstalled, ErrNotInstalled
+		return ServiceStatus{State: StateNotInstalled, Backend: "rc.d"}, nil
 	}
 
-	statusAction, _ := bsd.checkRunning()
+	return bsd.status(), nil
+}
+
+// Watch - Watch the service status
+func (bsd *bsdRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if _, err := bsd.StatusInfo(); err != nil {
+		return nil, err
+	}
 
-	return statusAction, nil
+	return watchStatus(ctx, func() ServiceStatus {
+		status, _ := bsd.StatusInfo()
+		return status
+	}, nil), nil
+}
+
+// Logs - Read the service log, the output of the service is not kept by
+// daemon(8)
+func (bsd *bsdRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	return nil, bsd.operationError("logs", ErrUnsupported)
 }
 
 // Run - Run service
 func (bsd *bsdRecord) Run(e Executable) (string, error) {
+	return bsd.RunContext(&executableAdapter{e})
+}
+
+// RunContext - Run context-aware service
+func (bsd *bsdRecord) RunContext(e ExecutableContext) (string, error) {
 	runAction := "Running " + bsd.description + ":"
-	e.Run()
+
+	if err := bsd.config.run(bsd.name, bsd.description, bsd.kind, e); err != nil {
+		return runAction + failed, bsd.operationError("run", err)
+	}
 	return runAction + " completed.", nil
 }
 
@@ -270,6 +433,8 @@ command="{{.Path}}"
 pidfile="/var/run/$name.pid"
 
 start_cmd="/usr/sbin/daemon -p $pidfile -f $command {{.Args}}"
+extra_commands="reload"
+sig_reload="HUP"
 load_rc_config $name
 run_rc_command "$1"
 `
@@ -0,0 +1,70 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/takama/daemon"
+	"github.com/takama/daemon/daemontest"
+)
+
+func TestRCInstallRoot(t *testing.T) {
+	root := t.TempDir()
+	service, err := daemon.NewWithOptions("daemon-test-service", "Test service", daemon.SystemDaemon,
+		daemon.WithRunner(&daemontest.Runner{}), daemon.WithRoot(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the missing directories are created in the alternate root
+	if _, err := service.Install("-v"); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	path := filepath.Join(root, "/usr/local/etc/rc.d/daemon-test-service")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("%s mode = %v; want 0755", path, info.Mode().Perm())
+	}
+
+	if _, err := service.Remove(); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s exists after Remove (%v)", path, err)
+	}
+}
+
+func TestRCInstallFailed(t *testing.T) {
+	root := t.TempDir()
+	errFailed := errors.New("command failed")
+	runner := &daemontest.Runner{}
+	runner.On("false", "", errFailed)
+	options := []daemon.Option{daemon.WithRunner(runner), daemon.WithRoot(root)}
+
+	service, err := daemon.NewWithOptions("daemon-test-service", "Test service", daemon.SystemDaemon, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := service.(daemon.Planner).PlanInstall("-v")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the script written before the failed step is removed
+	if err := daemon.ApplyFailing(plan, "false", options...); !errors.Is(err, errFailed) {
+		t.Fatalf("ApplyFailing() error = %v; want the failed command", err)
+	}
+	path := filepath.Join(root, "/usr/local/etc/rc.d/daemon-test-service")
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("%s exists after the failed install (%v)", path, err)
+	}
+}
@@ -6,19 +6,39 @@
 package daemon
 
 import (
+	"errors"
 	"os"
 )
 
 // Get the daemon properly
-func newDaemon(name, description string, kind Kind, dependencies []string) (Daemon, error) {
+func newDaemon(name, description string, kind Kind, cfg config) (Daemon, error) {
+	host := cfg.hostSystem()
+
 	// newer subsystem must be checked first
-	if _, err := os.Stat("/run/systemd/system"); err == nil {
-		return &systemDRecord{name, description, kind, dependencies}, nil
+	if host.exists("/run/systemd/system") {
+		// the unit files of user services are stored in the home directory,
+		// which is unknown without HOME and XDG_CONFIG_HOME
+		var configDir string
+		if kind == UserService {
+			dir, err := os.UserConfigDir()
+			if err != nil {
+				return nil, err
+			}
+			configDir = dir
+		}
+		return &systemDRecord{name, description, kind, cfg, configDir}, nil
+	}
+	if kind == UserService {
+		return nil, errors.New("User services are supported by systemd only")
+	}
+	if host.exists("/sbin/initctl") {
+		return &upstartRecord{name, description, kind, cfg}, nil
 	}
-	if _, err := os.Stat("/sbin/initctl"); err == nil {
-		return &upstartRecord{name, description, kind, dependencies}, nil
+	// without an init system the service daemonizes itself
+	if !host.exists("service") && !host.exists("/etc/init.d") {
+		return &detachedRecord{name, description, kind, cfg}, nil
 	}
-	return &systemVRecord{name, description, kind, dependencies}, nil
+	return &systemVRecord{name, description, kind, cfg}, nil
 }
 
 // Get executable path
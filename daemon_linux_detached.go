@@ -0,0 +1,364 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// detachedRecord - standard record (struct) for the linux systems without an
+// init system, the service daemonizes itself and is managed by its pid file
+type detachedRecord struct {
+	name        string
+	description string
+	kind        Kind
+	config      config
+}
+
+// Standard service path for the detached services: the executable and the
+// arguments, one per line
+func (linux *detachedRecord) servicePath() string {
+	return linux.config.path("/etc/" + linux.name + ".daemon")
+}
+
+// Error of the failed operation of the service
+func (linux *detachedRecord) operationError(op string, err error) error {
+	return newOperationError(op, "detached", linux.name, err)
+}
+
+// Is a service installed
+func (linux *detachedRecord) isInstalled() bool {
+	if _, err := os.Stat(linux.servicePath()); err == nil {
+		return true
+	}
+
+	return false
+}
+
+// Get status of the service from its pid file
+func (linux *detachedRecord) status() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "detached"}
+
+	if !linux.isInstalled() {
+		status.State = StateNotInstalled
+		return status
+	}
+
+	if pid := readPidFile(linux.config.pidFile(linux.name)); pid > 0 {
+		status.State = StateRunning
+		status.PID = pid
+		status.Since = procStartTime(pid)
+		return status
+	}
+
+	// the process is dead and its pid file still exists
+	if _, err := os.Stat(linux.config.pidFile(linux.name)); err == nil {
+		status.State = StateFailed
+	}
+
+	return status
+}
+
+// Is the elevation of the privileges enabled
+func (linux *detachedRecord) elevation() bool {
+	return linux.config.elevate
+}
+
+// Check service is running
+func (linux *detachedRecord) checkRunning() (string, bool) {
+	status := linux.status()
+	return status.String(), status.State == StateRunning
+}
+
+// Install the service
+func (linux *detachedRecord) Install(args ...string) (string, error) {
+	installAction := "Install " + linux.description + ":"
+
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return installAction + failed, linux.operationError("install", err)
+	}
+
+	plan, err := linux.PlanInstall(args...)
+	if err != nil {
+		return installAction + failed, linux.operationError("install", err)
+	}
+
+	if err := plan.apply(&linux.config); err != nil {
+		return installAction + failed, linux.operationError("install", err)
+	}
+
+	return installAction + success, nil
+}
+
+// PlanInstall - get the changes made by Install
+func (linux *detachedRecord) PlanInstall(args ...string) (Plan, error) {
+	var plan Plan
+
+	if linux.isInstalled() {
+		return plan, ErrAlreadyInstalled
+	}
+
+	execPatch, err := executablePath(linux.name)
+	if err != nil {
+		return plan, err
+	}
+
+	for _, arg := range args {
+		if strings.ContainsRune(arg, '\n') {
+			return plan, errors.New("Arguments of the detached service must not contain newlines")
+		}
+	}
+
+	plan.add(
+		writeFileStep(linux.servicePath(), strings.Join(append([]string{execPatch}, args...), "\n")+"\n", 0644),
+		removeStep(linux.servicePath(), true),
+	)
+
+	return plan, nil
+}
+
+// Remove the service
+func (linux *detachedRecord) Remove() (string, error) {
+	removeAction := "Removing " + linux.description + ":"
+
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return removeAction + failed, linux.operationError("remove", err)
+	}
+
+	plan, err := linux.PlanRemove()
+	if err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
+	}
+
+	if err := plan.apply(&linux.config); err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
+	}
+
+	return removeAction + success, nil
+}
+
+// PlanRemove - get the changes made by Remove
+func (linux *detachedRecord) PlanRemove() (Plan, error) {
+	var plan Plan
+
+	if !linux.isInstalled() {
+		return plan, ErrNotInstalled
+	}
+
+	plan.add(removeStep(linux.servicePath(), false))
+
+	return plan, nil
+}
+
+// Start the service
+func (linux *detachedRecord) Start() (string, error) {
+	startAction := "Starting " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return startAction + failed, linux.operationError("start", err)
+	}
+
+	if !linux.isInstalled() {
+		return startAction + failed, linux.operationError("start", ErrNotInstalled)
+	}
+
+	if _, ok := linux.checkRunning(); ok {
+		return startAction + failed, linux.operationError("start", ErrAlreadyRunning)
+	}
+
+	if err := linux.start(); err != nil {
+		return startAction + failed, linux.operationError("start", err)
+	}
+
+	return startAction + success, nil
+}
+
+// Start the installed command of the service detached
+func (linux *detachedRecord) start() error {
+	data, err := ioutil.ReadFile(linux.servicePath())
+	if err != nil {
+		return err
+	}
+
+	command := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	_, err = daemonize(linux.config, linux.name, command[0], command[1:])
+	return err
+}
+
+// Stop the service
+func (linux *detachedRecord) Stop() (string, error) {
+	stopAction := "Stopping " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return stopAction + failed, linux.operationError("stop", err)
+	}
+
+	if !linux.isInstalled() {
+		return stopAction + failed, linux.operationError("stop", ErrNotInstalled)
+	}
+
+	if _, ok := linux.checkRunning(); !ok {
+		return stopAction + failed, linux.operationError("stop", ErrAlreadyStopped)
+	}
+
+	if err := linux.stop(); err != nil {
+		return stopAction + failed, linux.operationError("stop", err)
+	}
+
+	return stopAction + success, nil
+}
+
+// Terminate the process of the service and remove its pid file, the service
+// is given the stop timeout to stop the executable
+func (linux *detachedRecord) stop() error {
+	timeout := linux.config.stopTimeout
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+
+	if pid := readPidFile(linux.config.pidFile(linux.name)); pid > 0 {
+		if err := terminateProcess(pid, timeout+defaultStopTimeout/2); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(linux.config.pidFile(linux.name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Restart the service
+func (linux *detachedRecord) Restart() (string, error) {
+	restartAction := "Restarting " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	if !linux.isInstalled() {
+		return restartAction + failed, linux.operationError("restart", ErrNotInstalled)
+	}
+
+	if err := linux.stop(); err != nil {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	if err := linux.start(); err != nil {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	return restartAction + success, nil
+}
+
+// Reload the service configuration
+func (linux *detachedRecord) Reload() (string, error) {
+	reloadAction := "Reloading " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	if !linux.isInstalled() {
+		return reloadAction + failed, linux.operationError("reload", ErrNotInstalled)
+	}
+
+	pid := readPidFile(linux.config.pidFile(linux.name))
+	if pid == 0 {
+		return reloadAction + failed, linux.operationError("reload", ErrAlreadyStopped)
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	return reloadAction + success, nil
+}
+
+// Enable the service, there is no init system to start it on boot
+func (linux *detachedRecord) Enable() (string, error) {
+	return "Enabling " + linux.description + ":" + failed, linux.operationError("enable", ErrUnsupported)
+}
+
+// Disable the service, there is no init system to start it on boot
+func (linux *detachedRecord) Disable() (string, error) {
+	return "Disabling " + linux.description + ":" + failed, linux.operationError("disable", ErrUnsupported)
+}
+
+// Status - Get service status
+func (linux *detachedRecord) Status() (string, error) {
+	status, err := formatStatus(linux.StatusInfo())
+	return status, linux.operationError("status", err)
+}
+
+// StatusInfo - Get structured service status
+func (linux *detachedRecord) StatusInfo() (ServiceStatus, error) {
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return ServiceStatus{}, linux.operationError("status", err)
+	}
+
+	return linux.status(), nil
+}
+
+// Watch - Watch the service status
+func (linux *detachedRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return nil, linux.operationError("watch", err)
+	}
+
+	return watchStatus(ctx, linux.status, nil), nil
+}
+
+// Logs - Read the service log from the log files
+func (linux *detachedRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	if !linux.isInstalled() {
+		return nil, linux.operationError("logs", ErrNotInstalled)
+	}
+
+	reader, err := fileLogs([]string{
+		linux.config.path("/var/log/" + linux.name + ".log"),
+		linux.config.path("/var/log/" + linux.name + ".err"),
+	}, opts)
+	if err != nil {
+		return nil, linux.operationError("logs", err)
+	}
+	return reader, nil
+}
+
+// Run - Run service
+func (linux *detachedRecord) Run(e Executable) (string, error) {
+	return linux.RunContext(&executableAdapter{e})
+}
+
+// RunContext - Run context-aware service
+func (linux *detachedRecord) RunContext(e ExecutableContext) (string, error) {
+	runAction := "Running " + linux.description + ":"
+
+	if err := linux.config.run(linux.name, linux.description, linux.kind, e); err != nil {
+		return runAction + failed, linux.operationError("run", err)
+	}
+	return runAction + " completed.", nil
+}
+
+// GetTemplate - gets service config template
+func (linux *detachedRecord) GetTemplate() string {
+	return ""
+}
+
+// SetTemplate - sets service config template
+func (linux *detachedRecord) SetTemplate(tplStr string) error {
+	return fmt.Errorf("templating is not supported for detached services: %w", ErrUnsupported)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build linux
+
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/takama/daemon"
+	"github.com/takama/daemon/daemontest"
+)
+
+// Create the detached service in the alternate root directory, the host
+// has no init system
+func newDetachedService(t *testing.T, root string, host *daemon.FakeHost) daemon.Daemon {
+	service, err := daemon.NewWithOptions(testService, "Test service", daemon.SystemDaemon,
+		daemon.WithRunner(&daemontest.Runner{}), daemon.WithRoot(root), daemon.WithHost(host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// Write the file in the alternate root directory
+func writeRootFile(t *testing.T, root, name, content string) {
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetachedRoot(t *testing.T) {
+	root := t.TempDir()
+	service := newDetachedService(t, root, &daemon.FakeHost{UID: 0})
+	if _, err := service.Install("-v"); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	// the pid file and the log files are read from the alternate root
+	writeRootFile(t, root, "/var/run/"+testService+".pid", strconv.Itoa(os.Getpid())+"\n")
+	writeRootFile(t, root, "/var/log/"+testService+".log", "started\n")
+
+	status, err := service.StatusInfo()
+	if err != nil {
+		t.Fatalf("StatusInfo() error = %v", err)
+	}
+	if status.State != daemon.StateRunning || status.PID != os.Getpid() {
+		t.Errorf("StatusInfo() = %v; want running with pid %d", status, os.Getpid())
+	}
+
+	reader, err := service.Logs(daemon.LogOptions{})
+	if err != nil {
+		t.Fatalf("Logs() error = %v", err)
+	}
+	defer reader.Close()
+	if data, _ := ioutil.ReadAll(reader); string(data) != "started\n" {
+		t.Errorf("Logs() = %q; want %q", data, "started\n")
+	}
+}
+
+func TestDetachedPrivileges(t *testing.T) {
+	service := newDetachedService(t, t.TempDir(), &daemon.FakeHost{UID: 1000, KnownCaps: true})
+
+	if _, err := service.StatusInfo(); !errors.Is(err, daemon.ErrRootPrivileges) {
+		t.Errorf("StatusInfo() error = %v; want ErrRootPrivileges", err)
+	}
+	if _, err := service.Watch(context.Background()); !errors.Is(err, daemon.ErrRootPrivileges) {
+		t.Errorf("Watch() error = %v; want ErrRootPrivileges", err)
+	}
+}
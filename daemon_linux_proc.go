@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of clock ticks per second used in /proc, fixed for user space
+const procClockTicks = 100
+
+// Get start time of the process from /proc, zero time if it is unknown
+func procStartTime(pid int) time.Time {
+	if pid <= 0 {
+		return time.Time{}
+	}
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	// the command name may contain spaces, so fields are counted after it
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return time.Time{}
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	// starttime is the 22nd field, the 20th one after the command name
+	if len(fields) < 20 {
+		return time.Time{}
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	boot := procBootTime()
+	if boot.IsZero() {
+		return time.Time{}
+	}
+	return boot.Add(time.Duration(ticks) * time.Second / procClockTicks)
+}
+
+// Get boot time of the system from /proc/stat
+func procBootTime() time.Time {
+	stat, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(stat), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(line[6:]), 10, 64); err == nil {
+				return time.Unix(sec, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Get the status of the service from its pid file and /proc, the service is
+// running if the process of the pid exists. False is returned if there is no
+// pid file, e.g. the service does not write it.
+func pidFileStatus(path string, status ServiceStatus) (ServiceStatus, bool) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return status, false
+	}
+
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid > 0 {
+		if _, err := os.Stat("/proc/" + strconv.Itoa(pid)); err == nil {
+			status.State = StateRunning
+			status.PID = pid
+			status.Since = procStartTime(pid)
+		}
+	}
+	return status, true
+}
+
+// Convert the monotonic timestamp of systemd in microseconds to the time,
+// zero time if it is not set or the monotonic clock is unknown
+func monotonicTime(usec uint64) time.Time {
+	now, ok := monotonicNow()
+	if usec == 0 || !ok {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(usec)*time.Microsecond - now)
+}
@@ -5,24 +5,120 @@
 package daemon
 
 import (
+	"context"
+	"io"
 	"os"
-	"os/exec"
-	"regexp"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"text/template"
 )
 
 // systemDRecord - standard record (struct) for linux systemD version of daemon package
 type systemDRecord struct {
-	name         string
-	description  string
-	kind         Kind
-	dependencies []string
+	name        string
+	description string
+	kind        Kind
+	config      config
+
+	// configuration directory of the user for UserService, resolved by
+	// newDaemon
+	configDir string
+}
+
+// Directory of the unit files, the units of user services are stored in
+// the configuration directory of the user
+func (linux *systemDRecord) unitDir() string {
+	if linux.kind == UserService {
+		return linux.config.path(filepath.Join(linux.configDir, "systemd/user"))
+	}
+	return linux.config.path("/etc/systemd/system/")
 }
 
 // Standard service path for systemD daemons
 func (linux *systemDRecord) servicePath() string {
-	return "/etc/systemd/system/" + linux.name + ".service"
+	return filepath.Join(linux.unitDir(), linux.name+".service")
+}
+
+// Name of the socket unit of the listen address with the index, the first
+// socket unit is named after the service, the next ones get the index
+func (linux *systemDRecord) socketUnit(index int) string {
+	if index == 0 {
+		return linux.name + ".socket"
+	}
+	return linux.name + "-" + strconv.Itoa(index) + ".socket"
+}
+
+// Standard socket path for socket activated systemD daemons
+func (linux *systemDRecord) socketPath(index int) string {
+	return filepath.Join(linux.unitDir(), linux.socketUnit(index))
+}
+
+// Installed socket units of the service, one unit per listen address
+func (linux *systemDRecord) socketUnits() []string {
+	var units []string
+	for i := 0; ; i++ {
+		if _, err := os.Stat(linux.socketPath(i)); err != nil {
+			return units
+		}
+		units = append(units, linux.socketUnit(i))
+	}
+}
+
+// Units of the service managed by systemctl, the socket units go first
+// so that the service is activated by them
+func (linux *systemDRecord) units() []string {
+	return append(linux.socketUnits(), linux.name+".service")
+}
+
+// Arguments of systemctl to enable or disable the units, the alternate
+// root directory is passed to systemctl
+func (linux *systemDRecord) unitFileArgs(command string, units []string) []string {
+	args := []string{command}
+	if linux.config.root != "" {
+		args = []string{"--root=" + linux.config.root, command}
+	}
+	return append(args, units...)
+}
+
+// Arguments of systemctl, user services are managed by the service
+// manager of the user
+func (linux *systemDRecord) systemctlArgs(args ...string) []string {
+	if linux.kind == UserService {
+		return append([]string{"--user"}, args...)
+	}
+	return args
+}
+
+// Run systemctl
+func (linux *systemDRecord) systemctl(args ...string) ([]byte, error) {
+	return linux.config.runner.Run("systemctl", linux.systemctlArgs(args...)...)
+}
+
+// Plan step running systemctl
+func (linux *systemDRecord) systemctlStep(args ...string) Step {
+	return commandStep("systemctl", linux.systemctlArgs(args...)...)
+}
+
+// Check the privileges, user services are managed without root privileges
+func (linux *systemDRecord) checkPrivileges() (bool, error) {
+	if linux.kind == UserService {
+		return true, nil
+	}
+	return linux.config.checkPrivileges()
+}
+
+// Check the privileges to change the unit files
+func (linux *systemDRecord) checkFilePrivileges() (bool, error) {
+	if linux.kind == UserService {
+		return true, nil
+	}
+	return linux.config.checkFilePrivileges()
+}
+
+// Error of the failed operation of the service
+func (linux *systemDRecord) operationError(op string, err error) error {
+	return newOperationError(op, "systemd", linux.name, err)
 }
 
 // Is a service installed
@@ -35,120 +131,200 @@ func (linux *systemDRecord) isInstalled() bool {
 	return false
 }
 
-// Check service is running
-func (linux *systemDRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("systemctl", "status", linux.name+".service").Output()
-	if err == nil {
-		if matched, err := regexp.MatchString("Active: active", string(output)); err == nil && matched {
-			reg := regexp.MustCompile("Main PID: ([0-9]+)")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
-			}
-			return "Service is running...", true
+// Properties of the service unit which define its status
+const systemDStatusProperties = "ActiveState,SubState,MainPID,ExecMainStatus,NRestarts,ActiveEnterTimestampMonotonic"
+
+// Get status of the service from "systemctl show" properties
+func (linux *systemDRecord) status() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "systemd"}
+
+	output, err := linux.systemctl("show", "--property="+systemDStatusProperties, linux.name+".service")
+	if err != nil {
+		return status
+	}
+
+	properties := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			properties[parts[0]] = strings.TrimSpace(parts[1])
 		}
 	}
 
-	return "Service is stopped", false
+	switch properties["ActiveState"] {
+	case "active", "reloading", "deactivating":
+		status.State = StateRunning
+	case "activating":
+		status.State = StateStarting
+	case "failed":
+		status.State = StateFailed
+	}
+
+	status.SubState = properties["SubState"]
+	status.PID, _ = strconv.Atoi(properties["MainPID"])
+	status.ExitCode, _ = strconv.Atoi(properties["ExecMainStatus"])
+	status.Restarts, _ = strconv.Atoi(properties["NRestarts"])
+	// the monotonic timestamp does not depend on the time zone and the
+	// locale of systemctl
+	if usec, err := strconv.ParseUint(properties["ActiveEnterTimestampMonotonic"], 10, 64); err == nil {
+		status.Since = monotonicTime(usec)
+	}
+
+	return status
+}
+
+// Check service is running
+func (linux *systemDRecord) checkRunning() (string, bool) {
+	status := linux.status()
+	return status.String(), status.State == StateRunning
 }
 
 // Install the service
 func (linux *systemDRecord) Install(args ...string) (string, error) {
 	installAction := "Install " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+	if ok, err := linux.checkFilePrivileges(); !ok {
+		return installAction + failed, linux.operationError("install", err)
 	}
 
-	srvPath := linux.servicePath()
+	plan, err := linux.PlanInstall(args...)
+	if err != nil {
+		return installAction + failed, linux.operationError("install", err)
+	}
 
-	if linux.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+	if err := plan.apply(&linux.config); err != nil {
+		return installAction + failed, linux.operationError("install", err)
 	}
 
-	file, err := os.Create(srvPath)
-	if err != nil {
-		return installAction + failed, err
+	return installAction + success, nil
+}
+
+// PlanInstall - get the changes made by Install
+func (linux *systemDRecord) PlanInstall(args ...string) (Plan, error) {
+	var plan Plan
+
+	if linux.isInstalled() {
+		return plan, ErrAlreadyInstalled
 	}
-	defer file.Close()
 
 	execPatch, err := executablePath(linux.name)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
-	templ, err := template.New("systemDConfig").Parse(systemDConfig)
+	data := newTemplateData(linux.name, linux.description, linux.config, execPatch, args)
+	data.UserService = linux.kind == UserService
+
+	content, err := renderTemplate("systemDConfig", systemDConfig, data)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
-
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Dependencies, Path, Args string
-		}{
-			linux.name,
-			linux.description,
-			strings.Join(linux.dependencies, " "),
-			execPatch,
-			strings.Join(args, " "),
-		},
-	); err != nil {
-		return installAction + failed, err
+	// the running systemd forgets the unit after the removal
+	// of the file only when the units are reloaded
+	reload := []Step{removeStep(linux.servicePath(), true)}
+	if linux.config.root == "" {
+		reload = append(reload, linux.systemctlStep("daemon-reload"))
+	}
+	plan.add(writeFileStep(linux.servicePath(), content, 0644), reload...)
+
+	// every listen address gets its own socket unit, as the name of the
+	// file descriptors is set per unit and Listen finds the socket by it
+	var units []string
+	for i, addr := range linux.config.sockets {
+		data := newTemplateData(linux.name, linux.description, linux.config, "", nil)
+		data.Sockets = listenAddresses([]string{addr})
+		data.SocketName = socketName(linux.name, addr)
+
+		content, err := renderTemplate("systemDSocketConfig", systemDSocketConfig, data)
+		if err != nil {
+			return plan, err
+		}
+		plan.add(
+			writeFileStep(linux.socketPath(i), content, 0644),
+			removeStep(linux.socketPath(i), true),
+		)
+		units = append(units, linux.socketUnit(i))
 	}
+	units = append(units, linux.name+".service")
 
-	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
-		return installAction + failed, err
+	// units in the alternate root are not loaded by the running systemd
+	if linux.config.root == "" {
+		plan.add(linux.systemctlStep("daemon-reload"))
 	}
 
-	if err := exec.Command("systemctl", "enable", linux.name+".service").Run(); err != nil {
-		return installAction + failed, err
+	plan.add(
+		linux.systemctlStep(linux.unitFileArgs("enable", units)...),
+		linux.systemctlStep(linux.unitFileArgs("disable", units)...),
+	)
+
+	// the services of the user are started on boot and keep running
+	// after the logout only if the user lingers
+	if linux.kind == UserService && linux.config.linger && linux.config.root == "" {
+		usr, err := user.Current()
+		if err != nil {
+			return plan, err
+		}
+		plan.add(commandStep("loginctl", "enable-linger", usr.Username))
 	}
 
-	return installAction + success, nil
+	return plan, nil
 }
 
 // Remove the service
 func (linux *systemDRecord) Remove() (string, error) {
 	removeAction := "Removing " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+	if ok, err := linux.checkFilePrivileges(); !ok {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if !linux.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+	plan, err := linux.PlanRemove()
+	if err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if err := exec.Command("systemctl", "disable", linux.name+".service").Run(); err != nil {
-		return removeAction + failed, err
+	if err := plan.apply(&linux.config); err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if err := os.Remove(linux.servicePath()); err != nil {
-		return removeAction + failed, err
+	return removeAction + success, nil
+}
+
+// PlanRemove - get the changes made by Remove
+func (linux *systemDRecord) PlanRemove() (Plan, error) {
+	var plan Plan
+
+	if !linux.isInstalled() {
+		return plan, ErrNotInstalled
 	}
 
-	return removeAction + success, nil
+	units := linux.units()
+	plan.add(linux.systemctlStep(linux.unitFileArgs("disable", units)...))
+	for i := range units[:len(units)-1] {
+		plan.add(removeStep(linux.socketPath(i), true))
+	}
+	plan.add(removeStep(linux.servicePath(), false))
+
+	return plan, nil
 }
 
 // Start the service
 func (linux *systemDRecord) Start() (string, error) {
 	startAction := "Starting " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+	if ok, err := linux.checkPrivileges(); !ok {
+		return startAction + failed, linux.operationError("start", err)
 	}
 
 	if !linux.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return startAction + failed, linux.operationError("start", ErrNotInstalled)
 	}
 
 	if _, ok := linux.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return startAction + failed, linux.operationError("start", ErrAlreadyRunning)
 	}
 
-	if err := exec.Command("systemctl", "start", linux.name+".service").Run(); err != nil {
-		return startAction + failed, err
+	if _, err := linux.systemctl(append([]string{"start"}, linux.units()...)...); err != nil {
+		return startAction + failed, linux.operationError("start", err)
 	}
 
 	return startAction + success, nil
@@ -158,45 +334,166 @@ func (linux *systemDRecord) Start() (string, error) {
 func (linux *systemDRecord) Stop() (string, error) {
 	stopAction := "Stopping " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+	if ok, err := linux.checkPrivileges(); !ok {
+		return stopAction + failed, linux.operationError("stop", err)
 	}
 
 	if !linux.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return stopAction + failed, linux.operationError("stop", ErrNotInstalled)
 	}
 
 	if _, ok := linux.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return stopAction + failed, linux.operationError("stop", ErrAlreadyStopped)
 	}
 
-	if err := exec.Command("systemctl", "stop", linux.name+".service").Run(); err != nil {
-		return stopAction + failed, err
+	if _, err := linux.systemctl(append([]string{"stop"}, linux.units()...)...); err != nil {
+		return stopAction + failed, linux.operationError("stop", err)
 	}
 
 	return stopAction + success, nil
 }
 
+// Restart the service
+func (linux *systemDRecord) Restart() (string, error) {
+	restartAction := "Restarting " + linux.description + ":"
+
+	if ok, err := linux.checkPrivileges(); !ok {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	if !linux.isInstalled() {
+		return restartAction + failed, linux.operationError("restart", ErrNotInstalled)
+	}
+
+	if _, err := linux.systemctl(append([]string{"restart"}, linux.units()...)...); err != nil {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	return restartAction + success, nil
+}
+
+// Reload the service configuration
+func (linux *systemDRecord) Reload() (string, error) {
+	reloadAction := "Reloading " + linux.description + ":"
+
+	if ok, err := linux.checkPrivileges(); !ok {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	if !linux.isInstalled() {
+		return reloadAction + failed, linux.operationError("reload", ErrNotInstalled)
+	}
+
+	if _, ok := linux.checkRunning(); !ok {
+		return reloadAction + failed, linux.operationError("reload", ErrAlreadyStopped)
+	}
+
+	if _, err := linux.systemctl("reload", linux.name+".service"); err != nil {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	return reloadAction + success, nil
+}
+
+// Enable the service
+func (linux *systemDRecord) Enable() (string, error) {
+	enableAction := "Enabling " + linux.description + ":"
+
+	if ok, err := linux.checkPrivileges(); !ok {
+		return enableAction + failed, linux.operationError("enable", err)
+	}
+
+	if !linux.isInstalled() {
+		return enableAction + failed, linux.operationError("enable", ErrNotInstalled)
+	}
+
+	if _, err := linux.systemctl(linux.unitFileArgs("enable", linux.units())...); err != nil {
+		return enableAction + failed, linux.operationError("enable", err)
+	}
+
+	return enableAction + success, nil
+}
+
+// Disable the service
+func (linux *systemDRecord) Disable() (string, error) {
+	disableAction := "Disabling " + linux.description + ":"
+
+	if ok, err := linux.checkPrivileges(); !ok {
+		return disableAction + failed, linux.operationError("disable", err)
+	}
+
+	if !linux.isInstalled() {
+		return disableAction + failed, linux.operationError("disable", ErrNotInstalled)
+	}
+
+	if _, err := linux.systemctl(linux.unitFileArgs("disable", linux.units())...); err != nil {
+		return disableAction + failed, linux.operationError("disable", err)
+	}
+
+	return disableAction + success, nil
+}
+
 // Status - Get service status
 func (linux *systemDRecord) Status() (string, error) {
+	status, err := formatStatus(linux.StatusInfo())
+	return status, linux.operationError("status", err)
+}
 
-	if ok, err := checkPrivileges(); !ok {
-		return "", err
+// StatusInfo - Get structured service status
+func (linux *systemDRecord) StatusInfo() (ServiceStatus, error) {
+
+	if ok, err := linux.checkPrivileges(); !ok {
+		return ServiceStatus{}, linux.operationError("status", err)
 	}
 
 	if !linux.isInstalled() {
-		return statNotInstalled, ErrNotInstalled
+		return ServiceStatus{State: StateNotInstalled, Backend: "systemd"}, nil
+	}
+
+	return linux.status(), nil
+}
+
+// Watch - Watch the service status
+func (linux *systemDRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if ok, err := linux.checkPrivileges(); !ok {
+		return nil, linux.operationError("watch", err)
 	}
 
-	statusAction, _ := linux.checkRunning()
+	// the changes of the unit are signaled over D-Bus if it is available,
+	// the status is checked periodically anyway
+	changed := watchSystemDUnit(ctx, linux.config.dbusAddress, linux.kind == UserService, linux.name+".service")
 
-	return statusAction, nil
+	return watchStatus(ctx, func() ServiceStatus {
+		status, _ := linux.StatusInfo()
+		return status
+	}, changed), nil
+}
+
+// Logs - Read the service log from the journal
+func (linux *systemDRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	if !linux.isInstalled() {
+		return nil, linux.operationError("logs", ErrNotInstalled)
+	}
+
+	reader, err := journalLogs(linux.config.runner, linux.kind == UserService, linux.name+".service", opts)
+	if err != nil {
+		return nil, linux.operationError("logs", err)
+	}
+	return reader, nil
 }
 
 // Run - Run service
 func (linux *systemDRecord) Run(e Executable) (string, error) {
+	return linux.RunContext(&executableAdapter{e})
+}
+
+// RunContext - Run context-aware service
+func (linux *systemDRecord) RunContext(e ExecutableContext) (string, error) {
 	runAction := "Running " + linux.description + ":"
-	e.Run()
+
+	if err := linux.config.run(linux.name, linux.description, linux.kind, e); err != nil {
+		return runAction + failed, linux.operationError("run", err)
+	}
 	return runAction + " completed.", nil
 }
 
@@ -212,16 +509,35 @@ func (linux *systemDRecord) SetTemplate(tplStr string) error {
 }
 
 var systemDConfig = `[Unit]
-Description={{.Description}}
+Description={{systemdEscape .Description}}
 Requires={{.Dependencies}}
 After={{.Dependencies}}
 
 [Service]
-PIDFile=/var/run/{{.Name}}.pid
+{{if .Notify}}Type=notify
+{{end}}{{if .Watchdog}}WatchdogSec={{.Watchdog}}
+{{end}}{{if not .UserService}}{{if .User}}User={{.User}}
+{{end}}{{if .Group}}Group={{.Group}}
+{{end}}{{end}}{{if .WorkDir}}WorkingDirectory={{systemdEscape .WorkDir}}
+{{end}}{{range .Env}}Environment={{systemdQuote .}}
+{{end}}{{if not .UserService}}PIDFile=/var/run/{{.Name}}.pid
 ExecStartPre=/bin/rm -f /var/run/{{.Name}}.pid
-ExecStart={{.Path}} {{.Args}}
+{{end}}ExecStart={{systemdExec .Path}}{{range .ArgList}} {{systemdExec .}}{{end}}
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=on-failure
 
 [Install]
-WantedBy=multi-user.target
+WantedBy={{if .UserService}}default.target{{else}}multi-user.target{{end}}
+`
+
+var systemDSocketConfig = `[Unit]
+Description={{systemdEscape .Description}} socket
+
+[Socket]
+{{range .Sockets}}ListenStream={{.}}
+{{end}}FileDescriptorName={{.SocketName}}
+Service={{.Name}}.service
+
+[Install]
+WantedBy=sockets.target
 `
@@ -0,0 +1,209 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build linux
+
+package daemon_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/takama/daemon"
+)
+
+const systemDShow = "systemctl show --property=ActiveState,SubState,MainPID,ExecMainStatus,NRestarts,ActiveEnterTimestampMonotonic " +
+	testService + ".service"
+
+func TestSystemDBackend(t *testing.T) {
+	runBackendTests(t, systemDHost, []backendTest{
+		{
+			name:     "install",
+			run:      install,
+			commands: []string{"systemctl --root=$ROOT enable " + testService + ".service"},
+			files: map[string]string{
+				"/etc/systemd/system/" + testService + ".service": `ExecStart="$EXEC" "-v"` + "\n",
+			},
+			absent: []string{"/etc/systemd/system/" + testService + ".socket"},
+		},
+		{
+			name:    "install with socket",
+			options: []daemon.Option{daemon.WithSocket(":8080")},
+			run:     install,
+			commands: []string{
+				"systemctl --root=$ROOT enable " + testService + ".socket " + testService + ".service",
+			},
+			files: map[string]string{
+				"/etc/systemd/system/" + testService + ".service": `ExecStart="$EXEC" "-v"` + "\n",
+				"/etc/systemd/system/" + testService + ".socket":  "ListenStream=8080\n",
+			},
+		},
+		{
+			name:    "install with sockets",
+			options: []daemon.Option{daemon.WithSocket(":8080", "127.0.0.1:9090")},
+			run:     install,
+			commands: []string{
+				"systemctl --root=$ROOT enable " + testService + ".socket " + testService + "-1.socket " +
+					testService + ".service",
+			},
+			files: map[string]string{
+				"/etc/systemd/system/" + testService + ".socket": "ListenStream=8080\n" +
+					"FileDescriptorName=" + testService + "-8080\n" +
+					"Service=" + testService + ".service\n",
+				"/etc/systemd/system/" + testService + "-1.socket": "ListenStream=127.0.0.1:9090\n" +
+					"FileDescriptorName=" + testService + "-127.0.0.1_9090\n" +
+					"Service=" + testService + ".service\n",
+			},
+			absent: []string{"/etc/systemd/system/" + testService + "-2.socket"},
+		},
+		{
+			name:      "remove with sockets",
+			options:   []daemon.Option{daemon.WithSocket(":8080", "127.0.0.1:9090")},
+			installed: true,
+			run:       remove,
+			commands: []string{
+				"systemctl --root=$ROOT disable " + testService + ".socket " + testService + "-1.socket " +
+					testService + ".service",
+			},
+			absent: []string{
+				"/etc/systemd/system/" + testService + ".socket",
+				"/etc/systemd/system/" + testService + "-1.socket",
+				"/etc/systemd/system/" + testService + ".service",
+			},
+		},
+		{
+			name:      "install installed",
+			installed: true,
+			run:       install,
+			err:       daemon.ErrAlreadyInstalled,
+		},
+		{
+			name:   "install failed",
+			errors: map[string]error{"systemctl --root=$ROOT enable": errCommand},
+			run:    install,
+			// the failed install is rolled back
+			commands: []string{
+				"systemctl --root=$ROOT enable " + testService + ".service",
+				"systemctl --root=$ROOT disable " + testService + ".service",
+			},
+			absent: []string{"/etc/systemd/system/" + testService + ".service"},
+			err:    errCommand,
+		},
+		{
+			name:      "remove",
+			installed: true,
+			run:       remove,
+			commands:  []string{"systemctl --root=$ROOT disable " + testService + ".service"},
+			absent:    []string{"/etc/systemd/system/" + testService + ".service"},
+		},
+		{
+			name:      "start",
+			installed: true,
+			run:       start,
+			commands:  []string{systemDShow, "systemctl start " + testService + ".service"},
+		},
+		{
+			name:      "start running",
+			installed: true,
+			results:   map[string]string{"systemctl show": "ActiveState=active\nMainPID=42\n"},
+			run:       start,
+			commands:  []string{systemDShow},
+			err:       daemon.ErrAlreadyRunning,
+		},
+		{
+			name: "start not installed",
+			run:  start,
+			err:  daemon.ErrNotInstalled,
+		},
+		{
+			name:      "stop",
+			installed: true,
+			results:   map[string]string{"systemctl show": "ActiveState=active\nMainPID=42\n"},
+			run:       stop,
+			commands:  []string{systemDShow, "systemctl stop " + testService + ".service"},
+		},
+		{
+			name:      "stop stopped",
+			installed: true,
+			results:   map[string]string{"systemctl show": "ActiveState=inactive\nMainPID=0\n"},
+			run:       stop,
+			commands:  []string{systemDShow},
+			err:       daemon.ErrAlreadyStopped,
+		},
+		{
+			name:      "enable",
+			installed: true,
+			run:       enable,
+			commands:  []string{"systemctl --root=$ROOT enable " + testService + ".service"},
+		},
+		{
+			name:      "disable",
+			installed: true,
+			run:       disable,
+			commands:  []string{"systemctl --root=$ROOT disable " + testService + ".service"},
+		},
+		{
+			name:      "status running",
+			installed: true,
+			results:   map[string]string{"systemctl show": "ActiveState=active\nSubState=running\nMainPID=42\n"},
+			run:       status(daemon.StateRunning, 42),
+			commands:  []string{systemDShow},
+		},
+		{
+			name:      "status failed",
+			installed: true,
+			results:   map[string]string{"systemctl show": "ActiveState=failed\nMainPID=0\nExecMainStatus=1\n"},
+			run:       status(daemon.StateFailed, 0),
+			commands:  []string{systemDShow},
+		},
+		{
+			name: "status not installed",
+			run:  status(daemon.StateNotInstalled, 0),
+		},
+		{
+			name:      "logs",
+			installed: true,
+			results:   map[string]string{"journalctl": systemDJournal},
+			run:       logs(daemon.LogOptions{Lines: 1}, systemDLog),
+			commands:  []string{"journalctl -u " + testService + ".service -o json -n 1"},
+		},
+		{
+			// the followed journal is read from the runner
+			name:      "logs follow",
+			installed: true,
+			results:   map[string]string{"journalctl": systemDJournal},
+			run:       logs(daemon.LogOptions{Follow: true}, systemDLog),
+			commands:  []string{"journalctl -u " + testService + ".service -o json -n all -f"},
+		},
+	})
+}
+
+// Entry of the journal and its line in the log
+const (
+	systemDJournal = `{"__REALTIME_TIMESTAMP":"1577959200000000","MESSAGE":"started"}` + "\n"
+	systemDLog     = "started\n"
+)
+
+// Logs operation which expects the log to end with the text
+func logs(opts daemon.LogOptions, want string) func(service daemon.Daemon) error {
+	return func(service daemon.Daemon) error {
+		reader, err := service.Logs(opts)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(string(data), " "+want) {
+			return errors.New("unexpected log " + strconv.Quote(string(data)))
+		}
+		return nil
+	}
+}
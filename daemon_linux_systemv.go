@@ -5,26 +5,42 @@
 package daemon
 
 import (
+	"context"
+	"io"
 	"os"
-	"os/exec"
 	"regexp"
-	"strings"
-	"text/template"
+	"strconv"
 )
 
 // systemVRecord - standard record (struct) for linux systemV version of daemon package
 type systemVRecord struct {
-	name         string
-	description  string
-	kind         Kind
-	dependencies []string
+	name        string
+	description string
+	kind        Kind
+	config      config
 }
 
 // Standard service path for systemV daemons
 func (linux *systemVRecord) servicePath() string {
+	return linux.config.path(linux.initScript())
+}
+
+// Path of the init script in the system, the target of the rc links
+func (linux *systemVRecord) initScript() string {
 	return "/etc/init.d/" + linux.name
 }
 
+// Path of the rc link of the service in the runlevel, the prefix
+// defines the action and order of the link
+func (linux *systemVRecord) rcLink(level, prefix string) string {
+	return linux.config.path("/etc/rc" + level + ".d/" + prefix + linux.name)
+}
+
+// Error of the failed operation of the service
+func (linux *systemVRecord) operationError(op string, err error) error {
+	return newOperationError(op, "sysv", linux.name, err)
+}
+
 // Is a service installed
 func (linux *systemVRecord) isInstalled() bool {
 
@@ -35,128 +51,204 @@ func (linux *systemVRecord) isInstalled() bool {
 	return false
 }
 
-// Check service is running
-func (linux *systemVRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("service", linux.name, "status").Output()
+// Get status of the service from "service <name> status" output
+func (linux *systemVRecord) status() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "sysv"}
+
+	output, err := linux.config.runner.Run("service", linux.name, "status")
 	if err == nil {
 		if matched, err := regexp.MatchString(linux.name, string(output)); err == nil && matched {
+			status.State = StateRunning
 			reg := regexp.MustCompile("pid  ([0-9]+)")
 			data := reg.FindStringSubmatch(string(output))
 			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
+				status.PID, _ = strconv.Atoi(data[1])
+				status.Since = procStartTime(status.PID)
 			}
-			return "Service is running...", true
 		}
+		return status
 	}
 
-	return "Service is stopped", false
+	// LSB exit codes of the status action: the program is dead
+	// and the pid file or the lock file still exists
+	switch exitStatus(err) {
+	case 1, 2:
+		status.State = StateFailed
+	}
+
+	return status
+}
+
+// Is the elevation of the privileges enabled
+func (linux *systemVRecord) elevation() bool {
+	return linux.config.elevate
+}
+
+// Get status of the service from its pid file and /proc, which is cheaper
+// than "service <name> status" for the frequent checks of Watch
+func (linux *systemVRecord) pidStatus() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "sysv"}
+
+	if !linux.isInstalled() {
+		status.State = StateNotInstalled
+		return status
+	}
+
+	status, _ = pidFileStatus(linux.config.path("/var/run/"+linux.name+".pid"), status)
+	if status.State == StateRunning {
+		return status
+	}
+
+	// LSB: the program is dead and the lock file still exists
+	if _, err := os.Stat(linux.config.path("/var/lock/subsys/" + linux.name)); err == nil {
+		status.State = StateFailed
+	}
+
+	return status
+}
+
+// Check service is running
+func (linux *systemVRecord) checkRunning() (string, bool) {
+	status := linux.status()
+	return status.String(), status.State == StateRunning
 }
 
 // Install the service
 func (linux *systemVRecord) Install(args ...string) (string, error) {
 	installAction := "Install " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return installAction + failed, linux.operationError("install", err)
 	}
 
-	srvPath := linux.servicePath()
+	plan, err := linux.PlanInstall(args...)
+	if err != nil {
+		return installAction + failed, linux.operationError("install", err)
+	}
 
-	if linux.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+	if err := plan.apply(&linux.config); err != nil {
+		return installAction + failed, linux.operationError("install", err)
 	}
 
-	file, err := os.Create(srvPath)
-	if err != nil {
-		return installAction + failed, err
+	return installAction + success, nil
+}
+
+// PlanInstall - get the changes made by Install
+func (linux *systemVRecord) PlanInstall(args ...string) (Plan, error) {
+	var plan Plan
+
+	if linux.isInstalled() {
+		return plan, ErrAlreadyInstalled
 	}
-	defer file.Close()
 
 	execPatch, err := executablePath(linux.name)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
-	templ, err := template.New("systemVConfig").Parse(systemVConfig)
+	content, err := renderTemplate(
+		"systemVConfig",
+		systemVConfig,
+		newTemplateData(linux.name, linux.description, linux.config, execPatch, args),
+	)
 	if err != nil {
-		return installAction + failed, err
-	}
-
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args string
-		}{linux.name, linux.description, execPatch, strings.Join(args, " ")},
-	); err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
-
-	if err := os.Chmod(srvPath, 0755); err != nil {
-		return installAction + failed, err
+	plan.add(
+		writeFileStep(linux.servicePath(), content, 0755),
+		removeStep(linux.servicePath(), true),
+	)
+
+	if linux.config.logrotate != nil {
+		content, err := renderLogRotation(linux.config.logrotate, []string{
+			"/var/log/" + linux.name + ".log",
+			"/var/log/" + linux.name + ".err",
+		}, "cat /var/run/"+linux.name+".pid 2>/dev/null")
+		if err != nil {
+			return plan, err
+		}
+		plan.add(
+			writeFileStep(linux.config.path(logRotationPath(linux.name)), content, 0644),
+			removeStep(linux.config.path(logRotationPath(linux.name)), true),
+		)
 	}
 
 	for _, i := range [...]string{"2", "3", "4", "5"} {
-		if err := os.Symlink(srvPath, "/etc/rc"+i+".d/S87"+linux.name); err != nil {
-			continue
-		}
+		plan.add(
+			symlinkStep(linux.initScript(), linux.rcLink(i, "S87")),
+			removeStep(linux.rcLink(i, "S87"), true),
+		)
 	}
 	for _, i := range [...]string{"0", "1", "6"} {
-		if err := os.Symlink(srvPath, "/etc/rc"+i+".d/K17"+linux.name); err != nil {
-			continue
-		}
+		plan.add(
+			symlinkStep(linux.initScript(), linux.rcLink(i, "K17")),
+			removeStep(linux.rcLink(i, "K17"), true),
+		)
 	}
 
-	return installAction + success, nil
+	return plan, nil
 }
 
 // Remove the service
 func (linux *systemVRecord) Remove() (string, error) {
 	removeAction := "Removing " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if !linux.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+	plan, err := linux.PlanRemove()
+	if err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if err := os.Remove(linux.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := plan.apply(&linux.config); err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
+	}
+
+	return removeAction + success, nil
+}
+
+// PlanRemove - get the changes made by Remove
+func (linux *systemVRecord) PlanRemove() (Plan, error) {
+	var plan Plan
+
+	if !linux.isInstalled() {
+		return plan, ErrNotInstalled
 	}
 
+	plan.add(removeStep(linux.servicePath(), false))
+	plan.add(removeStep(linux.config.path(logRotationPath(linux.name)), true))
+
 	for _, i := range [...]string{"2", "3", "4", "5"} {
-		if err := os.Remove("/etc/rc" + i + ".d/S87" + linux.name); err != nil {
-			continue
-		}
+		plan.add(removeStep(linux.rcLink(i, "S87"), true))
 	}
-	for _, i := range [...]string{"0", "1", "6"} {
-		if err := os.Remove("/etc/rc" + i + ".d/K17" + linux.name); err != nil {
-			continue
-		}
+	// the stop links of the disabled service are in all runlevels
+	for _, i := range [...]string{"0", "1", "2", "3", "4", "5", "6"} {
+		plan.add(removeStep(linux.rcLink(i, "K17"), true))
 	}
 
-	return removeAction + success, nil
+	return plan, nil
 }
 
 // Start the service
 func (linux *systemVRecord) Start() (string, error) {
 	startAction := "Starting " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return startAction + failed, linux.operationError("start", err)
 	}
 
 	if !linux.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return startAction + failed, linux.operationError("start", ErrNotInstalled)
 	}
 
 	if _, ok := linux.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return startAction + failed, linux.operationError("start", ErrAlreadyRunning)
 	}
 
-	if err := exec.Command("service", linux.name, "start").Run(); err != nil {
-		return startAction + failed, err
+	if _, err := linux.config.runner.Run("service", linux.name, "start"); err != nil {
+		return startAction + failed, linux.operationError("start", err)
 	}
 
 	return startAction + success, nil
@@ -166,45 +258,179 @@ func (linux *systemVRecord) Start() (string, error) {
 func (linux *systemVRecord) Stop() (string, error) {
 	stopAction := "Stopping " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return stopAction + failed, linux.operationError("stop", err)
 	}
 
 	if !linux.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return stopAction + failed, linux.operationError("stop", ErrNotInstalled)
 	}
 
 	if _, ok := linux.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return stopAction + failed, linux.operationError("stop", ErrAlreadyStopped)
 	}
 
-	if err := exec.Command("service", linux.name, "stop").Run(); err != nil {
-		return stopAction + failed, err
+	if _, err := linux.config.runner.Run("service", linux.name, "stop"); err != nil {
+		return stopAction + failed, linux.operationError("stop", err)
 	}
 
 	return stopAction + success, nil
 }
 
+// Restart the service
+func (linux *systemVRecord) Restart() (string, error) {
+	restartAction := "Restarting " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	if !linux.isInstalled() {
+		return restartAction + failed, linux.operationError("restart", ErrNotInstalled)
+	}
+
+	if _, err := linux.config.runner.Run("service", linux.name, "restart"); err != nil {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	return restartAction + success, nil
+}
+
+// Reload the service configuration
+func (linux *systemVRecord) Reload() (string, error) {
+	reloadAction := "Reloading " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	if !linux.isInstalled() {
+		return reloadAction + failed, linux.operationError("reload", ErrNotInstalled)
+	}
+
+	if _, ok := linux.checkRunning(); !ok {
+		return reloadAction + failed, linux.operationError("reload", ErrAlreadyStopped)
+	}
+
+	if _, err := linux.config.runner.Run("service", linux.name, "reload"); err != nil {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	return reloadAction + success, nil
+}
+
+// Enable the service
+func (linux *systemVRecord) Enable() (string, error) {
+	enableAction := "Enabling " + linux.description + ":"
+
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return enableAction + failed, linux.operationError("enable", err)
+	}
+
+	if !linux.isInstalled() {
+		return enableAction + failed, linux.operationError("enable", ErrNotInstalled)
+	}
+
+	if err := linux.switchLinks("K17", "S87"); err != nil {
+		return enableAction + failed, linux.operationError("enable", err)
+	}
+
+	return enableAction + success, nil
+}
+
+// Disable the service
+func (linux *systemVRecord) Disable() (string, error) {
+	disableAction := "Disabling " + linux.description + ":"
+
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return disableAction + failed, linux.operationError("disable", err)
+	}
+
+	if !linux.isInstalled() {
+		return disableAction + failed, linux.operationError("disable", ErrNotInstalled)
+	}
+
+	// the stop links of the runlevels 0, 1 and 6 are kept, so the service
+	// is still stopped on shutdown
+	if err := linux.switchLinks("S87", "K17"); err != nil {
+		return disableAction + failed, linux.operationError("disable", err)
+	}
+
+	return disableAction + success, nil
+}
+
+// Replace the links of the service in the runlevels 2-5 with the prefix by
+// the links with another prefix, like update-rc.d does: the enabled service
+// has the start links, the disabled one the stop links
+func (linux *systemVRecord) switchLinks(from, to string) error {
+	for _, i := range [...]string{"2", "3", "4", "5"} {
+		if err := os.Symlink(linux.initScript(), linux.rcLink(i, to)); err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err := os.Remove(linux.rcLink(i, from)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
 // Status - Get service status
 func (linux *systemVRecord) Status() (string, error) {
+	status, err := formatStatus(linux.StatusInfo())
+	return status, linux.operationError("status", err)
+}
 
-	if ok, err := checkPrivileges(); !ok {
-		return "", err
+// StatusInfo - Get structured service status
+func (linux *systemVRecord) StatusInfo() (ServiceStatus, error) {
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return ServiceStatus{}, linux.operationError("status", err)
 	}
 
 	if !linux.isInstalled() {
-		return statNotInstalled, ErrNotInstalled
+		return ServiceStatus{State: StateNotInstalled, Backend: "sysv"}, nil
+	}
+
+	return linux.status(), nil
+}
+
+// Watch - Watch the service status
+func (linux *systemVRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return nil, linux.operationError("watch", err)
 	}
 
-	statusAction, _ := linux.checkRunning()
+	return watchStatus(ctx, linux.pidStatus, nil), nil
+}
+
+// Logs - Read the service log from the log files
+func (linux *systemVRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	if !linux.isInstalled() {
+		return nil, linux.operationError("logs", ErrNotInstalled)
+	}
 
-	return statusAction, nil
+	reader, err := fileLogs([]string{
+		linux.config.path("/var/log/" + linux.name + ".log"),
+		linux.config.path("/var/log/" + linux.name + ".err"),
+	}, opts)
+	if err != nil {
+		return nil, linux.operationError("logs", err)
+	}
+	return reader, nil
 }
 
 // Run - Run service
 func (linux *systemVRecord) Run(e Executable) (string, error) {
+	return linux.RunContext(&executableAdapter{e})
+}
+
+// RunContext - Run context-aware service
+func (linux *systemVRecord) RunContext(e ExecutableContext) (string, error) {
 	runAction := "Running " + linux.description + ":"
-	e.Run()
+
+	if err := linux.config.run(linux.name, linux.description, linux.kind, e); err != nil {
+		return runAction + failed, linux.operationError("run", err)
+	}
 	return runAction + " completed.", nil
 }
 
@@ -245,8 +471,8 @@ if [ -f /etc/rc.d/init.d/functions ]; then
     . /etc/rc.d/init.d/functions
 fi
 
-exec="{{.Path}}"
-servname="{{.Description}}"
+exec={{quote .Path}}
+servname={{quote .Description}}
 
 proc="{{.Name}}"
 pidfile="/var/run/$proc.pid"
@@ -257,12 +483,15 @@ stderrlog="/var/log/$proc.err"
 [ -d $(dirname $lockfile) ] || mkdir -p $(dirname $lockfile)
 
 [ -e /etc/sysconfig/$proc ] && . /etc/sysconfig/$proc
+{{range .Env}}
+export {{quote .}}{{end}}
 
 start() {
-    [ -x $exec ] || exit 5
+    [ -x "$exec" ] || exit 5
 
     if [ -f $pidfile ]; then
-        if ! [ -d "/proc/$(cat $pidfile)" ]; then
+        pid=$(cat $pidfile)
+        if [ -z "$pid" ] || ! [ -d "/proc/$pid" ]; then
             rm $pidfile
             if [ -f $lockfile ]; then
                 rm $lockfile
@@ -273,8 +502,25 @@ start() {
     if ! [ -f $pidfile ]; then
         printf "Starting $servname:\t"
         echo "$(date)" >> $stdoutlog
-        $exec {{.Args}} >> $stdoutlog 2>> $stderrlog &
+{{- if .WorkDir}}
+        cd {{quote .WorkDir}} || exit 1
+{{- end}}
+{{- if or .User .Group}}
+        # $! is the pid of su, the service writes its own pid to the pid
+        # file owned by its user, the pid of su is kept if it does not
+        : > $pidfile
+        chown {{quote (or .User "root")}}{{if .Group}}:{{quote .Group}}{{end}} $pidfile
+        su -s /bin/sh {{if .Group}}-g {{quote .Group}} {{end}}-c {{quote (printf "exec %s%s" (quote .Path) (quoteArgs .ArgList))}} {{quote (or .User "root")}} >> $stdoutlog 2>> $stderrlog &
+        supid=$!
+        for i in 1 2 3 4 5; do
+            [ -s $pidfile ] && break
+            sleep 1
+        done
+        [ -s $pidfile ] || echo $supid > $pidfile
+{{- else}}
+        "$exec"{{quoteArgs .ArgList}} >> $stdoutlog 2>> $stderrlog &
         echo $! > $pidfile
+{{- end}}
         touch $lockfile
         success
         echo
@@ -300,6 +546,14 @@ restart() {
     start
 }
 
+reload() {
+    echo -n $"Reloading $servname: "
+    killproc -p $pidfile $proc -HUP
+    retval=$?
+    echo
+    return $retval
+}
+
 rh_status() {
     status -p $pidfile $proc
 }
@@ -320,11 +574,15 @@ case "$1" in
     restart)
         $1
         ;;
+    reload)
+        rh_status_q || exit 7
+        $1
+        ;;
     status)
         rh_status
         ;;
     *)
-        echo $"Usage: $0 {start|stop|status|restart}"
+        echo $"Usage: $0 {start|stop|status|restart|reload}"
         exit 2
 esac
 
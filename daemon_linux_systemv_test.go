@@ -0,0 +1,163 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build linux
+
+package daemon_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/takama/daemon"
+	"github.com/takama/daemon/daemontest"
+)
+
+// Links of the installed and enabled service in the runlevels
+var systemVLinks = map[string]string{
+	"/etc/rc0.d/K17" + testService: "-> /etc/init.d/" + testService,
+	"/etc/rc1.d/K17" + testService: "-> /etc/init.d/" + testService,
+	"/etc/rc2.d/S87" + testService: "-> /etc/init.d/" + testService,
+	"/etc/rc3.d/S87" + testService: "-> /etc/init.d/" + testService,
+	"/etc/rc4.d/S87" + testService: "-> /etc/init.d/" + testService,
+	"/etc/rc5.d/S87" + testService: "-> /etc/init.d/" + testService,
+	"/etc/rc6.d/K17" + testService: "-> /etc/init.d/" + testService,
+}
+
+// Files of the installed service, the init script and the links
+func systemVFiles() map[string]string {
+	files := map[string]string{"/etc/init.d/" + testService: "exec='$EXEC'"}
+	for link, target := range systemVLinks {
+		files[link] = target
+	}
+	return files
+}
+
+// Links of the disabled service, the start links are replaced by the stop
+// links
+func disabledSystemVLinks() map[string]string {
+	links := map[string]string{}
+	for link, target := range systemVLinks {
+		links[strings.Replace(link, "/S87", "/K17", 1)] = target
+	}
+	return links
+}
+
+func TestSystemVBackend(t *testing.T) {
+	var allLinks []string
+	for link := range systemVLinks {
+		allLinks = append(allLinks, link)
+	}
+	var startLinks, stopLinks []string
+	for _, level := range []string{"2", "3", "4", "5"} {
+		startLinks = append(startLinks, "/etc/rc"+level+".d/S87"+testService)
+		stopLinks = append(stopLinks, "/etc/rc"+level+".d/K17"+testService)
+	}
+
+	runBackendTests(t, systemVHost, []backendTest{
+		{
+			name:  "install",
+			run:   install,
+			files: systemVFiles(),
+		},
+		{
+			name:      "install installed",
+			installed: true,
+			run:       install,
+			err:       daemon.ErrAlreadyInstalled,
+		},
+		{
+			name:      "remove",
+			installed: true,
+			run:       remove,
+			absent:    append([]string{"/etc/init.d/" + testService}, allLinks...),
+		},
+		{
+			name:      "start",
+			installed: true,
+			errors:    map[string]error{"service " + testService + " status": &daemontest.ExitError{Code: 3}},
+			run:       start,
+			commands:  []string{"service " + testService + " status", "service " + testService + " start"},
+		},
+		{
+			name:      "start running",
+			installed: true,
+			results:   map[string]string{"service " + testService + " status": testService + " (pid  42) is running...\n"},
+			run:       start,
+			commands:  []string{"service " + testService + " status"},
+			err:       daemon.ErrAlreadyRunning,
+		},
+		{
+			name:      "stop",
+			installed: true,
+			results:   map[string]string{"service " + testService + " status": testService + " (pid  42) is running...\n"},
+			run:       stop,
+			commands:  []string{"service " + testService + " status", "service " + testService + " stop"},
+		},
+		{
+			name:      "stop stopped",
+			installed: true,
+			errors:    map[string]error{"service " + testService + " status": &daemontest.ExitError{Code: 3}},
+			run:       stop,
+			commands:  []string{"service " + testService + " status"},
+			err:       daemon.ErrAlreadyStopped,
+		},
+		{
+			name:      "enable",
+			installed: true,
+			run: func(service daemon.Daemon) error {
+				if err := disable(service); err != nil {
+					return err
+				}
+				return enable(service)
+			},
+			files:  systemVFiles(),
+			absent: stopLinks,
+		},
+		{
+			// the files in the alternate root are changed without privileges
+			name:      "enable as user",
+			options:   []daemon.Option{daemon.WithHost(&daemon.FakeHost{UID: 1000, Files: systemVHost})},
+			installed: true,
+			run:       enable,
+			files:     systemVFiles(),
+		},
+		{
+			name:      "disable",
+			installed: true,
+			run:       disable,
+			files:     disabledSystemVLinks(),
+			absent:    startLinks,
+		},
+		{
+			name:      "remove disabled",
+			installed: true,
+			run: func(service daemon.Daemon) error {
+				if err := disable(service); err != nil {
+					return err
+				}
+				return remove(service)
+			},
+			absent: append(append([]string{"/etc/init.d/" + testService}, allLinks...), stopLinks...),
+		},
+		{
+			name:      "status running",
+			installed: true,
+			results:   map[string]string{"service " + testService + " status": testService + " (pid  42) is running...\n"},
+			run:       status(daemon.StateRunning, 42),
+			commands:  []string{"service " + testService + " status"},
+		},
+		{
+			name:      "status failed",
+			installed: true,
+			errors:    map[string]error{"service " + testService + " status": &daemontest.ExitError{Code: 1}},
+			run:       status(daemon.StateFailed, 0),
+			commands:  []string{"service " + testService + " status"},
+		},
+		{
+			name: "status not installed",
+			run:  status(daemon.StateNotInstalled, 0),
+		},
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateData - values available in the service config templates,
+// the same for all linux init systems. Args are the arguments joined by
+// spaces as they are given, ArgList are the arguments to be quoted by
+// the template
+type templateData struct {
+	Name, Description, Dependencies, Path, Args string
+	ArgList                                     []string
+	User, Group, WorkDir                        string
+	Env                                         []string
+	Notify                                      bool
+	Watchdog                                    string
+	Sockets                                     []string
+	SocketName                                  string
+	UserService                                 bool
+}
+
+// Collect the service config template values
+func newTemplateData(name, description string, cfg config, path string, args []string) *templateData {
+	return &templateData{
+		Name:         name,
+		Description:  description,
+		Dependencies: strings.Join(cfg.dependencies, " "),
+		Path:         path,
+		Args:         strings.Join(args, " "),
+		ArgList:      args,
+		User:         cfg.user,
+		Group:        cfg.group,
+		WorkDir:      cfg.workDir,
+		Env:          cfg.env,
+		Notify:       cfg.notify,
+		Watchdog:     formatTimespan(cfg.watchdog),
+		Sockets:      listenAddresses(cfg.sockets),
+	}
+}
+
+// Convert listen addresses to the systemd socket unit syntax, where a port
+// without a host is written as a plain number
+func listenAddresses(addrs []string) []string {
+	var result []string
+	for _, addr := range addrs {
+		result = append(result, strings.TrimPrefix(addr, ":"))
+	}
+	return result
+}
+
+// Name of the socket of the service passed by socket activation, it is
+// derived from the listen address, so Listen finds the socket of the address
+// among the sockets of the service. The names of the file descriptors can not
+// contain colons and non-ASCII characters, they are replaced by underscores
+func socketName(name, addr string) string {
+	return name + "-" + strings.Map(func(r rune) rune {
+		if r == ':' || r > '~' {
+			return '_'
+		}
+		return r
+	}, strings.TrimPrefix(addr, ":"))
+}
+
+// Format duration as a systemd time span, empty for zero duration
+func formatTimespan(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	return strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms"
+}
+
+// Functions available in the service config templates
+var templateFuncs = template.FuncMap{
+	// quote - quotes a string to be used as a single word in a shell script
+	"quote": shellQuote,
+
+	// quoteArgs - quotes the arguments for a shell script, each argument
+	// is preceded by the space
+	"quoteArgs": func(args []string) string {
+		var result string
+		for _, arg := range args {
+			result += " " + shellQuote(arg)
+		}
+		return result
+	},
+
+	// systemdEscape - escapes the specifiers in a value of a unit file
+	// setting which is not quoted, e.g. WorkingDirectory
+	"systemdEscape": func(s string) string {
+		return strings.Replace(s, "%", "%%", -1)
+	},
+
+	// systemdQuote - quotes a string to be used as a single word in a unit
+	// file setting, e.g. Environment
+	"systemdQuote": func(s string) string {
+		return systemdQuote(s, false)
+	},
+
+	// systemdExec - quotes a string to be used as a single word of the
+	// command line in a unit file, the variables are not expanded
+	"systemdExec": func(s string) string {
+		return systemdQuote(s, true)
+	},
+
+	// upstartQuote - quotes a string to be used as a single argument of
+	// an upstart stanza, e.g. env or chdir
+	"upstartQuote": func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	},
+}
+
+// Quote the string to be used as a single word in a shell script
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Quote the string in the unit file syntax of systemd: the C-like escapes
+// in the double quotes, the specifiers and optionally the variables of the
+// command lines are escaped
+func systemdQuote(s string, exec bool) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '%':
+			buf.WriteString("%%")
+		case r == '$' && exec:
+			buf.WriteString("$$")
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&buf, "\\x%02x", r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// Render the service config template
+func renderTemplate(name, text string, data *templateData) (string, error) {
+	templ, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"strings"
+	"testing"
+)
+
+// Values of the options which must be escaped in the service files
+func hostileTemplateData() *templateData {
+	cfg := config{
+		user:    "svc",
+		group:   "svc",
+		workDir: `/srv/my "app" 100%`,
+		env:     []string{`GREETING=it's "$HOME" at 100%`, `PATTERN=a\b`},
+	}
+	return newTemplateData("test", "Test 100% service", cfg, "/opt/my app/bin", []string{"--name=$USER", "it's", "a b", `c"d`})
+}
+
+func TestRenderTemplateQuoting(t *testing.T) {
+	tests := []struct {
+		name, template string
+		lines          []string
+	}{
+		{"systemd", systemDConfig, []string{
+			"Description=Test 100%% service",
+			`WorkingDirectory=/srv/my "app" 100%%`,
+			`Environment="GREETING=it's \"$HOME\" at 100%%"`,
+			`Environment="PATTERN=a\\b"`,
+			`ExecStart="/opt/my app/bin" "--name=$$USER" "it's" "a b" "c\"d"`,
+		}},
+		{"upstart", upstatConfig, []string{
+			`description     "Test 100% service"`,
+			"setuid svc",
+			"setgid svc",
+			`chdir "/srv/my \"app\" 100%"`,
+			`env "GREETING=it's \"$HOME\" at 100%"`,
+			`env "PATTERN=a\\b"`,
+			`exec '/opt/my app/bin' '--name=$USER' 'it'\''s' 'a b' 'c"d' >> /var/log/test.log 2>> /var/log/test.err`,
+		}},
+		{"sysv", systemVConfig, []string{
+			"exec='/opt/my app/bin'",
+			"servname='Test 100% service'",
+			`export 'GREETING=it'\''s "$HOME" at 100%'`,
+			`        cd '/srv/my "app" 100%' || exit 1`,
+			`        su -s /bin/sh -g 'svc' -c 'exec '\''/opt/my app/bin'\'' '\''--name=$USER'\'' '\''it'\''\'\'''\''s'\'' '\''a b'\'' '\''c"d'\''' 'svc' >> $stdoutlog 2>> $stderrlog &`,
+			// the service writes its pid, not su
+			"        chown 'svc':'svc' $pidfile",
+			"        [ -s $pidfile ] || echo $supid > $pidfile",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := renderTemplate(test.name, test.template, hostileTemplateData())
+			if err != nil {
+				t.Fatalf("renderTemplate() error = %v", err)
+			}
+			lines := strings.Split(content, "\n")
+			for _, want := range test.lines {
+				found := false
+				for _, line := range lines {
+					if line == want {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("line %s not found in:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemDQuoteControl(t *testing.T) {
+	if got, want := systemdQuote("a\tb\x7f", false), `"a\x09b\x7f"`; got != want {
+		t.Errorf("systemdQuote() = %s; want %s", got, want)
+	}
+}
+
+func TestSystemDUserServiceAccount(t *testing.T) {
+	data := hostileTemplateData()
+	data.UserService = true
+
+	content, err := renderTemplate("systemd", systemDConfig, data)
+	if err != nil {
+		t.Fatalf("renderTemplate() error = %v", err)
+	}
+	if strings.Contains(content, "User=") || strings.Contains(content, "Group=") {
+		t.Errorf("user service runs as another account:\n%s", content)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewDaemonBackend(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  Daemon
+	}{
+		{"systemd", []string{"/run/systemd/system", "/sbin/initctl", "service", "/etc/init.d"}, &systemDRecord{}},
+		{"upstart", []string{"/sbin/initctl", "service", "/etc/init.d"}, &upstartRecord{}},
+		{"sysv", []string{"service"}, &systemVRecord{}},
+		{"sysv without service command", []string{"/etc/init.d"}, &systemVRecord{}},
+		{"detached", nil, &detachedRecord{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config{host: &FakeHost{Files: test.files}}
+			daemon, err := newDaemon("test", "Test service", SystemDaemon, cfg)
+			if err != nil {
+				t.Fatalf("newDaemon() error = %v", err)
+			}
+			if reflect.TypeOf(daemon) != reflect.TypeOf(test.want) {
+				t.Errorf("newDaemon() = %T; want %T", daemon, test.want)
+			}
+		})
+	}
+}
+
+func TestNewDaemonUserService(t *testing.T) {
+	cfg := config{host: &FakeHost{Files: []string{"/sbin/initctl"}}}
+	if _, err := newDaemon("test", "Test service", UserService, cfg); err == nil {
+		t.Error("newDaemon() of the user service without systemd succeeded")
+	}
+
+	cfg = config{host: &FakeHost{Files: []string{"/run/systemd/system"}}}
+	t.Setenv("HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if _, err := newDaemon("test", "Test service", UserService, cfg); err == nil {
+		t.Error("newDaemon() of the user service without the home directory succeeded")
+	}
+
+	// the directory is resolved once, the unit is not moved by the changed
+	// environment
+	t.Setenv("XDG_CONFIG_HOME", "/home/user/.config")
+	daemon, err := newDaemon("test", "Test service", UserService, cfg)
+	if err != nil {
+		t.Fatalf("newDaemon() error = %v", err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", "")
+	if path := daemon.(*systemDRecord).servicePath(); path != "/home/user/.config/systemd/user/test.service" {
+		t.Errorf("servicePath() = %q; want the unit in XDG_CONFIG_HOME", path)
+	}
+}
+
+func TestUpstartPidStatus(t *testing.T) {
+	root := t.TempDir()
+	runner := &fallbackRunner{}
+	linux := &upstartRecord{"test", "Test service", SystemDaemon, config{root: root, runner: runner}}
+
+	if status := linux.pidStatus(); status.State != StateNotInstalled {
+		t.Errorf("pidStatus() = %v; want not installed", status)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, "etc/init"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(linux.servicePath(), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the command is run if the service does not write the pid file
+	linux.pidStatus()
+	if want := []string{"status test"}; !reflect.DeepEqual(runner.commands, want) {
+		t.Errorf("commands = %q; want %q", runner.commands, want)
+	}
+	runner.commands = nil
+
+	pidFile := filepath.Join(root, "var/run/test.pid")
+	if err := os.MkdirAll(filepath.Dir(pidFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := linux.pidStatus(); status.State != StateRunning || status.PID != os.Getpid() {
+		t.Errorf("pidStatus() = %v; want running with pid %d", status, os.Getpid())
+	}
+
+	// the pid of the process which does not exist
+	if err := ioutil.WriteFile(pidFile, []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := linux.pidStatus(); status.State != StateStopped {
+		t.Errorf("pidStatus() = %v; want stopped", status)
+	}
+
+	if len(runner.commands) != 0 {
+		t.Errorf("commands = %q; want none with the pid file", runner.commands)
+	}
+}
+
+func TestMonotonicTime(t *testing.T) {
+	now, ok := monotonicNow()
+	if !ok {
+		t.Skip("monotonic clock is unknown")
+	}
+
+	want := time.Now().Add(-time.Minute)
+	since := monotonicTime(uint64((now - time.Minute) / time.Microsecond))
+	if d := since.Sub(want); d > time.Second || d < -time.Second {
+		t.Errorf("monotonicTime() = %v; want %v", since, want)
+	}
+
+	if since := monotonicTime(0); !since.IsZero() {
+		t.Errorf("monotonicTime(0) = %v; want zero time", since)
+	}
+}
@@ -5,24 +5,35 @@
 package daemon
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"regexp"
-	"strings"
-	"text/template"
+	"strconv"
 )
 
 // upstartRecord - standard record (struct) for linux upstart version of daemon package
 type upstartRecord struct {
-	name         string
-	description  string
-	kind         Kind
-	dependencies []string
+	name        string
+	description string
+	kind        Kind
+	config      config
 }
 
 // Standard service path for systemV daemons
 func (linux *upstartRecord) servicePath() string {
-	return "/etc/init/" + linux.name + ".conf"
+	return linux.config.path("/etc/init/" + linux.name + ".conf")
+}
+
+// Override path which disables start of the service on boot
+func (linux *upstartRecord) overridePath() string {
+	return linux.config.path("/etc/init/" + linux.name + ".override")
+}
+
+// Error of the failed operation of the service
+func (linux *upstartRecord) operationError(op string, err error) error {
+	return newOperationError(op, "upstart", linux.name, err)
 }
 
 // Is a service installed
@@ -35,106 +46,191 @@ func (linux *upstartRecord) isInstalled() bool {
 	return false
 }
 
-// Check service is running
-func (linux *upstartRecord) checkRunning() (string, bool) {
-	output, err := exec.Command("status", linux.name).Output()
+// Get status of the service from "status <name>" output
+func (linux *upstartRecord) status() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "upstart"}
+
+	output, err := linux.config.runner.Run("status", linux.name)
 	if err == nil {
-		if matched, err := regexp.MatchString(linux.name+" start/running", string(output)); err == nil && matched {
-			reg := regexp.MustCompile("process ([0-9]+)")
-			data := reg.FindStringSubmatch(string(output))
-			if len(data) > 1 {
-				return "Service (pid  " + data[1] + ") is running...", true
+		reg := regexp.MustCompile(regexp.QuoteMeta(linux.name) + " (start|stop)/([a-z-]+)")
+		if data := reg.FindStringSubmatch(string(output)); len(data) > 2 {
+			switch {
+			case data[1] == "start" && data[2] == "running":
+				status.State = StateRunning
+			case data[1] == "start":
+				status.State = StateStarting
 			}
-			return "Service is running...", true
+		}
+		reg = regexp.MustCompile("process ([0-9]+)")
+		data := reg.FindStringSubmatch(string(output))
+		if len(data) > 1 && status.State != StateStopped {
+			status.PID, _ = strconv.Atoi(data[1])
+			status.Since = procStartTime(status.PID)
 		}
 	}
 
-	return "Service is stopped", false
+	return status
+}
+
+// Get status of the service from its pid file and /proc, which is cheaper
+// than "status <name>" for the frequent checks of Watch, the command is run
+// only if the service does not write the pid file
+func (linux *upstartRecord) pidStatus() ServiceStatus {
+	status := ServiceStatus{State: StateStopped, Backend: "upstart"}
+
+	if !linux.isInstalled() {
+		status.State = StateNotInstalled
+		return status
+	}
+
+	if status, ok := pidFileStatus(linux.config.path("/var/run/"+linux.name+".pid"), status); ok {
+		return status
+	}
+
+	return linux.status()
+}
+
+// Is the elevation of the privileges enabled
+func (linux *upstartRecord) elevation() bool {
+	return linux.config.elevate
+}
+
+// Check service is running
+func (linux *upstartRecord) checkRunning() (string, bool) {
+	status := linux.status()
+	return status.String(), status.State == StateRunning
 }
 
 // Install the service
 func (linux *upstartRecord) Install(args ...string) (string, error) {
 	installAction := "Install " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return installAction + failed, err
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return installAction + failed, linux.operationError("install", err)
 	}
 
-	srvPath := linux.servicePath()
+	plan, err := linux.PlanInstall(args...)
+	if err != nil {
+		return installAction + failed, linux.operationError("install", err)
+	}
 
-	if linux.isInstalled() {
-		return installAction + failed, ErrAlreadyInstalled
+	if err := plan.apply(&linux.config); err != nil {
+		return installAction + failed, linux.operationError("install", err)
 	}
 
-	file, err := os.Create(srvPath)
-	if err != nil {
-		return installAction + failed, err
+	return installAction + success, nil
+}
+
+// PlanInstall - get the changes made by Install
+func (linux *upstartRecord) PlanInstall(args ...string) (Plan, error) {
+	var plan Plan
+
+	if linux.isInstalled() {
+		return plan, ErrAlreadyInstalled
 	}
-	defer file.Close()
 
 	execPatch, err := executablePath(linux.name)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
 
-	templ, err := template.New("upstatConfig").Parse(upstatConfig)
+	content, err := renderTemplate(
+		"upstatConfig",
+		upstatConfig,
+		newTemplateData(linux.name, linux.description, linux.config, execPatch, args),
+	)
 	if err != nil {
-		return installAction + failed, err
+		return plan, err
 	}
-
-	if err := templ.Execute(
-		file,
-		&struct {
-			Name, Description, Path, Args string
-		}{linux.name, linux.description, execPatch, strings.Join(args, " ")},
-	); err != nil {
-		return installAction + failed, err
+	plan.add(
+		writeFileStep(linux.servicePath(), content, 0755),
+		removeStep(linux.servicePath(), true),
+	)
+
+	// the output of the job is redirected after setuid, so the log files
+	// are created in advance with the owner who can write them, the log
+	// files of the former installation are kept by the rollback
+	if linux.config.user != "" || linux.config.group != "" {
+		for _, path := range []string{"/var/log/" + linux.name + ".log", "/var/log/" + linux.name + ".err"} {
+			path = linux.config.path(path)
+			var undo []Step
+			if _, err := os.Lstat(path); os.IsNotExist(err) {
+				undo = append(undo, removeStep(path, true))
+			}
+			plan.add(createFileStep(path, 0644, linux.config.user, linux.config.group), undo...)
+		}
 	}
 
-	if err := os.Chmod(srvPath, 0755); err != nil {
-		return installAction + failed, err
+	if linux.config.logrotate != nil {
+		content, err := renderLogRotation(linux.config.logrotate, []string{
+			"/var/log/" + linux.name + ".log",
+			"/var/log/" + linux.name + ".err",
+		}, "initctl status "+linux.name+` | sed -n 's/.*process \([0-9]*\).*/\1/p'`)
+		if err != nil {
+			return plan, err
+		}
+		plan.add(
+			writeFileStep(linux.config.path(logRotationPath(linux.name)), content, 0644),
+			removeStep(linux.config.path(logRotationPath(linux.name)), true),
+		)
 	}
 
-	return installAction + success, nil
+	return plan, nil
 }
 
 // Remove the service
 func (linux *upstartRecord) Remove() (string, error) {
 	removeAction := "Removing " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return removeAction + failed, err
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if !linux.isInstalled() {
-		return removeAction + failed, ErrNotInstalled
+	plan, err := linux.PlanRemove()
+	if err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
-	if err := os.Remove(linux.servicePath()); err != nil {
-		return removeAction + failed, err
+	if err := plan.apply(&linux.config); err != nil {
+		return removeAction + failed, linux.operationError("remove", err)
 	}
 
 	return removeAction + success, nil
 }
 
+// PlanRemove - get the changes made by Remove
+func (linux *upstartRecord) PlanRemove() (Plan, error) {
+	var plan Plan
+
+	if !linux.isInstalled() {
+		return plan, ErrNotInstalled
+	}
+
+	plan.add(removeStep(linux.overridePath(), true))
+	plan.add(removeStep(linux.config.path(logRotationPath(linux.name)), true))
+	plan.add(removeStep(linux.servicePath(), false))
+
+	return plan, nil
+}
+
 // Start the service
 func (linux *upstartRecord) Start() (string, error) {
 	startAction := "Starting " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return startAction + failed, err
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return startAction + failed, linux.operationError("start", err)
 	}
 
 	if !linux.isInstalled() {
-		return startAction + failed, ErrNotInstalled
+		return startAction + failed, linux.operationError("start", ErrNotInstalled)
 	}
 
 	if _, ok := linux.checkRunning(); ok {
-		return startAction + failed, ErrAlreadyRunning
+		return startAction + failed, linux.operationError("start", ErrAlreadyRunning)
 	}
 
-	if err := exec.Command("start", linux.name).Run(); err != nil {
-		return startAction + failed, err
+	if _, err := linux.config.runner.Run("start", linux.name); err != nil {
+		return startAction + failed, linux.operationError("start", err)
 	}
 
 	return startAction + success, nil
@@ -144,45 +240,169 @@ func (linux *upstartRecord) Start() (string, error) {
 func (linux *upstartRecord) Stop() (string, error) {
 	stopAction := "Stopping " + linux.description + ":"
 
-	if ok, err := checkPrivileges(); !ok {
-		return stopAction + failed, err
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return stopAction + failed, linux.operationError("stop", err)
 	}
 
 	if !linux.isInstalled() {
-		return stopAction + failed, ErrNotInstalled
+		return stopAction + failed, linux.operationError("stop", ErrNotInstalled)
 	}
 
 	if _, ok := linux.checkRunning(); !ok {
-		return stopAction + failed, ErrAlreadyStopped
+		return stopAction + failed, linux.operationError("stop", ErrAlreadyStopped)
 	}
 
-	if err := exec.Command("stop", linux.name).Run(); err != nil {
-		return stopAction + failed, err
+	if _, err := linux.config.runner.Run("stop", linux.name); err != nil {
+		return stopAction + failed, linux.operationError("stop", err)
 	}
 
 	return stopAction + success, nil
 }
 
+// Restart the service
+func (linux *upstartRecord) Restart() (string, error) {
+	restartAction := "Restarting " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	if !linux.isInstalled() {
+		return restartAction + failed, linux.operationError("restart", ErrNotInstalled)
+	}
+
+	// upstart restarts running jobs only
+	command := "restart"
+	if _, ok := linux.checkRunning(); !ok {
+		command = "start"
+	}
+
+	if _, err := linux.config.runner.Run(command, linux.name); err != nil {
+		return restartAction + failed, linux.operationError("restart", err)
+	}
+
+	return restartAction + success, nil
+}
+
+// Reload the service configuration
+func (linux *upstartRecord) Reload() (string, error) {
+	reloadAction := "Reloading " + linux.description + ":"
+
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	if !linux.isInstalled() {
+		return reloadAction + failed, linux.operationError("reload", ErrNotInstalled)
+	}
+
+	if _, ok := linux.checkRunning(); !ok {
+		return reloadAction + failed, linux.operationError("reload", ErrAlreadyStopped)
+	}
+
+	if _, err := linux.config.runner.Run("reload", linux.name); err != nil {
+		return reloadAction + failed, linux.operationError("reload", err)
+	}
+
+	return reloadAction + success, nil
+}
+
+// Enable the service
+func (linux *upstartRecord) Enable() (string, error) {
+	enableAction := "Enabling " + linux.description + ":"
+
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return enableAction + failed, linux.operationError("enable", err)
+	}
+
+	if !linux.isInstalled() {
+		return enableAction + failed, linux.operationError("enable", ErrNotInstalled)
+	}
+
+	if err := os.Remove(linux.overridePath()); err != nil && !os.IsNotExist(err) {
+		return enableAction + failed, linux.operationError("enable", err)
+	}
+
+	return enableAction + success, nil
+}
+
+// Disable the service
+func (linux *upstartRecord) Disable() (string, error) {
+	disableAction := "Disabling " + linux.description + ":"
+
+	if ok, err := linux.config.checkFilePrivileges(); !ok {
+		return disableAction + failed, linux.operationError("disable", err)
+	}
+
+	if !linux.isInstalled() {
+		return disableAction + failed, linux.operationError("disable", ErrNotInstalled)
+	}
+
+	// the "manual" stanza ignores start conditions of the job
+	if err := ioutil.WriteFile(linux.overridePath(), []byte("manual\n"), 0644); err != nil {
+		return disableAction + failed, linux.operationError("disable", err)
+	}
+
+	return disableAction + success, nil
+}
+
 // Status - Get service status
 func (linux *upstartRecord) Status() (string, error) {
+	status, err := formatStatus(linux.StatusInfo())
+	return status, linux.operationError("status", err)
+}
+
+// StatusInfo - Get structured service status
+func (linux *upstartRecord) StatusInfo() (ServiceStatus, error) {
 
-	if ok, err := checkPrivileges(); !ok {
-		return "", err
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return ServiceStatus{}, linux.operationError("status", err)
 	}
 
 	if !linux.isInstalled() {
-		return statNotInstalled, ErrNotInstalled
+		return ServiceStatus{State: StateNotInstalled, Backend: "upstart"}, nil
+	}
+
+	return linux.status(), nil
+}
+
+// Watch - Watch the service status
+func (linux *upstartRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if ok, err := linux.config.checkPrivileges(); !ok {
+		return nil, linux.operationError("watch", err)
 	}
 
-	statusAction, _ := linux.checkRunning()
+	return watchStatus(ctx, linux.pidStatus, nil), nil
+}
+
+// Logs - Read the service log from the log files
+func (linux *upstartRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	if !linux.isInstalled() {
+		return nil, linux.operationError("logs", ErrNotInstalled)
+	}
 
-	return statusAction, nil
+	reader, err := fileLogs([]string{
+		linux.config.path("/var/log/" + linux.name + ".log"),
+		linux.config.path("/var/log/" + linux.name + ".err"),
+	}, opts)
+	if err != nil {
+		return nil, linux.operationError("logs", err)
+	}
+	return reader, nil
 }
 
 // Run - Run service
 func (linux *upstartRecord) Run(e Executable) (string, error) {
+	return linux.RunContext(&executableAdapter{e})
+}
+
+// RunContext - Run context-aware service
+func (linux *upstartRecord) RunContext(e ExecutableContext) (string, error) {
 	runAction := "Running " + linux.description + ":"
-	e.Run()
+
+	if err := linux.config.run(linux.name, linux.description, linux.kind, e); err != nil {
+		return runAction + failed, linux.operationError("run", err)
+	}
 	return runAction + " completed.", nil
 }
 
@@ -199,7 +419,7 @@ func (linux *upstartRecord) SetTemplate(tplStr string) error {
 
 var upstatConfig = `# {{.Name}} {{.Description}}
 
-description     "{{.Description}}"
+description     {{upstartQuote .Description}}
 author          "Pichu Chen <pichu@tih.tw>"
 
 start on runlevel [2345]
@@ -207,6 +427,11 @@ stop on runlevel [016]
 
 respawn
 #kill timeout 5
+{{if .User}}
+setuid {{.User}}{{end}}{{if .Group}}
+setgid {{.Group}}{{end}}{{if .WorkDir}}
+chdir {{upstartQuote .WorkDir}}{{end}}{{range .Env}}
+env {{upstartQuote .}}{{end}}
 
-exec {{.Path}} {{.Args}} >> /var/log/{{.Name}}.log 2>> /var/log/{{.Name}}.err
+exec {{quote .Path}}{{quoteArgs .ArgList}} >> /var/log/{{.Name}}.log 2>> /var/log/{{.Name}}.err
 `
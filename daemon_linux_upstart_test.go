@@ -0,0 +1,172 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build linux
+
+package daemon_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/takama/daemon"
+	"github.com/takama/daemon/daemontest"
+)
+
+func TestUpstartBackend(t *testing.T) {
+	runBackendTests(t, upstartHost, []backendTest{
+		{
+			name: "install",
+			run:  install,
+			files: map[string]string{
+				"/etc/init/" + testService + ".conf": "exec '$EXEC' '-v'",
+			},
+			absent: []string{"/etc/logrotate.d/" + testService},
+		},
+		{
+			name:    "install with user",
+			options: []daemon.Option{daemon.WithUser("svc"), daemon.WithGroup("svc")},
+			run:     install,
+			files: map[string]string{
+				"/etc/init/" + testService + ".conf": "setuid svc\nsetgid svc\n",
+				"/var/log/" + testService + ".log":   "",
+				"/var/log/" + testService + ".err":   "",
+			},
+		},
+		{
+			name:    "install with log rotation",
+			options: []daemon.Option{daemon.WithLogRotation(daemon.LogRotation{Schedule: "weekly"})},
+			run:     install,
+			files: map[string]string{
+				"/etc/init/" + testService + ".conf": "exec '$EXEC' '-v'",
+				"/etc/logrotate.d/" + testService:    "weekly\n",
+			},
+		},
+		{
+			name:      "install installed",
+			installed: true,
+			run:       install,
+			err:       daemon.ErrAlreadyInstalled,
+		},
+		{
+			name:      "remove",
+			installed: true,
+			run:       remove,
+			absent:    []string{"/etc/init/" + testService + ".conf"},
+		},
+		{
+			name:      "start",
+			installed: true,
+			results:   map[string]string{"status": testService + " stop/waiting\n"},
+			run:       start,
+			commands:  []string{"status " + testService, "start " + testService},
+		},
+		{
+			name:      "start running",
+			installed: true,
+			results:   map[string]string{"status": testService + " start/running, process 42\n"},
+			run:       start,
+			commands:  []string{"status " + testService},
+			err:       daemon.ErrAlreadyRunning,
+		},
+		{
+			name:      "stop",
+			installed: true,
+			results:   map[string]string{"status": testService + " start/running, process 42\n"},
+			run:       stop,
+			commands:  []string{"status " + testService, "stop " + testService},
+		},
+		{
+			name:      "stop stopped",
+			installed: true,
+			results:   map[string]string{"status": testService + " stop/waiting\n"},
+			run:       stop,
+			commands:  []string{"status " + testService},
+			err:       daemon.ErrAlreadyStopped,
+		},
+		{
+			name:      "disable",
+			installed: true,
+			run:       disable,
+			files:     map[string]string{"/etc/init/" + testService + ".override": "manual\n"},
+		},
+		{
+			name:      "enable",
+			installed: true,
+			run: func(service daemon.Daemon) error {
+				if err := disable(service); err != nil {
+					return err
+				}
+				return enable(service)
+			},
+			absent: []string{"/etc/init/" + testService + ".override"},
+		},
+		{
+			name:      "status running",
+			installed: true,
+			results:   map[string]string{"status": testService + " start/running, process 42\n"},
+			run:       status(daemon.StateRunning, 42),
+			commands:  []string{"status " + testService},
+		},
+		{
+			name:      "status starting",
+			installed: true,
+			results:   map[string]string{"status": testService + " start/pre-start, process 42\n"},
+			run:       status(daemon.StateStarting, 42),
+			commands:  []string{"status " + testService},
+		},
+		{
+			name: "status not installed",
+			run:  status(daemon.StateNotInstalled, 0),
+		},
+	})
+}
+
+func TestUpstartInstallFailed(t *testing.T) {
+	root := t.TempDir()
+	runner := &daemontest.Runner{}
+	runner.On("false", "", errCommand)
+	host := rootIdentity
+	host.Files = upstartHost
+	options := []daemon.Option{
+		daemon.WithRunner(runner),
+		daemon.WithRoot(root),
+		daemon.WithHost(&host),
+		daemon.WithUser("svc"),
+	}
+
+	// the log of the former installation is kept
+	errPath := filepath.Join(root, "/var/log/"+testService+".err")
+	if err := os.MkdirAll(filepath.Dir(errPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(errPath, []byte("failure\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := daemon.NewWithOptions(testService, "Test service", daemon.SystemDaemon, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := service.(daemon.Planner).PlanInstall("-v")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the job and the log created before the failed step are removed
+	if err := daemon.ApplyFailing(plan, "false", options...); !errors.Is(err, errCommand) {
+		t.Fatalf("ApplyFailing() error = %v; want the failed command", err)
+	}
+	for _, name := range []string{"/etc/init/" + testService + ".conf", "/var/log/" + testService + ".log"} {
+		if _, err := os.Lstat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("%s exists after the failed install (%v)", name, err)
+		}
+	}
+	if data, err := ioutil.ReadFile(errPath); err != nil || string(data) != "failure\n" {
+		t.Errorf("former log = %q, %v; want it kept", data, err)
+	}
+}
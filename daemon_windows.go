@@ -6,8 +6,9 @@
 package daemon
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"io"
 	"os/exec"
 	"strconv"
 	"syscall"
@@ -15,6 +16,7 @@ import (
 	"unicode/utf16"
 	"unsafe"
 
+	winapi "golang.org/x/sys/windows"
 	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
@@ -22,15 +24,20 @@ import (
 
 // windowsRecord - standard record (struct) for windows version of daemon package
 type windowsRecord struct {
-	name         string
-	description  string
-	kind         Kind
-	dependencies []string
+	name        string
+	description string
+	kind        Kind
+	config      config
 }
 
-func newDaemon(name, description string, kind Kind, dependencies []string) (Daemon, error) {
+func newDaemon(name, description string, kind Kind, cfg config) (Daemon, error) {
 
-	return &windowsRecord{name, description, kind, dependencies}, nil
+	return &windowsRecord{name, description, kind, cfg}, nil
+}
+
+// Error of the failed operation of the service
+func (windows *windowsRecord) operationError(op string, err error) error {
+	return newOperationError(op, "windows", windows.name, err)
 }
 
 // Install the service
@@ -40,29 +47,29 @@ func (windows *windowsRecord) Install(args ...string) (string, error) {
 	execp, err := execPath()
 
 	if err != nil {
-		return installAction + failed, err
+		return installAction + failed, windows.operationError("install", err)
 	}
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return installAction + failed, err
+		return installAction + failed, windows.operationError("install", err)
 	}
 	defer m.Disconnect()
 
 	s, err := m.OpenService(windows.name)
 	if err == nil {
 		s.Close()
-		return installAction + failed, ErrAlreadyRunning
+		return installAction + failed, windows.operationError("install", ErrAlreadyRunning)
 	}
 
 	s, err = m.CreateService(windows.name, execp, mgr.Config{
 		DisplayName:  windows.name,
 		Description:  windows.description,
 		StartType:    mgr.StartAutomatic,
-		Dependencies: windows.dependencies,
+		Dependencies: windows.config.dependencies,
 	}, args...)
 	if err != nil {
-		return installAction + failed, err
+		return installAction + failed, windows.operationError("install", err)
 	}
 	defer s.Close()
 
@@ -90,6 +97,18 @@ func (windows *windowsRecord) Install(args ...string) (string, error) {
 	// set reset period as a day
 	s.SetRecoveryActions(r, uint32(86400))
 
+	// take recovery actions also if the service stops with an error, the
+	// service which is not restarted on failure is not installed
+	failureActionsOnNonCrashFailures := uint32(1)
+	if err := winapi.ChangeServiceConfig2(
+		s.Handle,
+		winapi.SERVICE_CONFIG_FAILURE_ACTIONS_FLAG,
+		(*byte)(unsafe.Pointer(&failureActionsOnNonCrashFailures)),
+	); err != nil {
+		s.Delete()
+		return installAction + failed, windows.operationError("install", err)
+	}
+
 	return installAction + " completed.", nil
 }
 
@@ -99,17 +118,17 @@ func (windows *windowsRecord) Remove() (string, error) {
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return removeAction + failed, getWindowsError(err)
+		return removeAction + failed, windows.operationError("remove", getWindowsError(err))
 	}
 	defer m.Disconnect()
 	s, err := m.OpenService(windows.name)
 	if err != nil {
-		return removeAction + failed, getWindowsError(err)
+		return removeAction + failed, windows.operationError("remove", getWindowsError(err))
 	}
 	defer s.Close()
 	err = s.Delete()
 	if err != nil {
-		return removeAction + failed, getWindowsError(err)
+		return removeAction + failed, windows.operationError("remove", getWindowsError(err))
 	}
 
 	return removeAction + " completed.", nil
@@ -121,16 +140,16 @@ func (windows *windowsRecord) Start() (string, error) {
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return startAction + failed, getWindowsError(err)
+		return startAction + failed, windows.operationError("start", getWindowsError(err))
 	}
 	defer m.Disconnect()
 	s, err := m.OpenService(windows.name)
 	if err != nil {
-		return startAction + failed, getWindowsError(err)
+		return startAction + failed, windows.operationError("start", getWindowsError(err))
 	}
 	defer s.Close()
 	if err = s.Start(); err != nil {
-		return startAction + failed, getWindowsError(err)
+		return startAction + failed, windows.operationError("start", getWindowsError(err))
 	}
 
 	return startAction + " completed.", nil
@@ -142,21 +161,107 @@ func (windows *windowsRecord) Stop() (string, error) {
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return stopAction + failed, getWindowsError(err)
+		return stopAction + failed, windows.operationError("stop", getWindowsError(err))
 	}
 	defer m.Disconnect()
 	s, err := m.OpenService(windows.name)
 	if err != nil {
-		return stopAction + failed, getWindowsError(err)
+		return stopAction + failed, windows.operationError("stop", getWindowsError(err))
 	}
 	defer s.Close()
 	if err := stopAndWait(s); err != nil {
-		return stopAction + failed, getWindowsError(err)
+		return stopAction + failed, windows.operationError("stop", getWindowsError(err))
 	}
 
 	return stopAction + " completed.", nil
 }
 
+// Restart the service
+func (windows *windowsRecord) Restart() (string, error) {
+	restartAction := "Restarting " + windows.description + ":"
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return restartAction + failed, windows.operationError("restart", getWindowsError(err))
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.name)
+	if err != nil {
+		return restartAction + failed, windows.operationError("restart", getWindowsError(err))
+	}
+	defer s.Close()
+	status, err := s.Query()
+	if err != nil {
+		return restartAction + failed, windows.operationError("restart", getWindowsError(err))
+	}
+	if status.State != svc.Stopped {
+		if err := stopAndWait(s); err != nil {
+			return restartAction + failed, windows.operationError("restart", getWindowsError(err))
+		}
+	}
+	if err = s.Start(); err != nil {
+		return restartAction + failed, windows.operationError("restart", getWindowsError(err))
+	}
+
+	return restartAction + " completed.", nil
+}
+
+// Reload the service configuration, the service manager sends the parameter
+// change request to the service
+func (windows *windowsRecord) Reload() (string, error) {
+	reloadAction := "Reloading " + windows.description + ":"
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return reloadAction + failed, windows.operationError("reload", getWindowsError(err))
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.name)
+	if err != nil {
+		return reloadAction + failed, windows.operationError("reload", getWindowsError(err))
+	}
+	defer s.Close()
+	if _, err := s.Control(svc.ParamChange); err != nil {
+		return reloadAction + failed, windows.operationError("reload", getWindowsError(err))
+	}
+
+	return reloadAction + " completed.", nil
+}
+
+// Enable the service
+func (windows *windowsRecord) Enable() (string, error) {
+	return windows.setStartType("enable", "Enabling "+windows.description+":", mgr.StartAutomatic)
+}
+
+// Disable the service
+func (windows *windowsRecord) Disable() (string, error) {
+	return windows.setStartType("disable", "Disabling "+windows.description+":", mgr.StartDisabled)
+}
+
+// Change start type of the service
+func (windows *windowsRecord) setStartType(op, action string, startType uint32) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return action + failed, windows.operationError(op, getWindowsError(err))
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.name)
+	if err != nil {
+		return action + failed, windows.operationError(op, getWindowsError(err))
+	}
+	defer s.Close()
+	config, err := s.Config()
+	if err != nil {
+		return action + failed, windows.operationError(op, getWindowsError(err))
+	}
+	config.StartType = startType
+	if err := s.UpdateConfig(config); err != nil {
+		return action + failed, windows.operationError(op, getWindowsError(err))
+	}
+
+	return action + " completed.", nil
+}
+
 func stopAndWait(s *mgr.Service) error {
 	// First stop the service. Then wait for the service to
 	// actually stop before starting it.
@@ -179,7 +284,7 @@ func stopAndWait(s *mgr.Service) error {
 				return err
 			}
 		case <-timeout:
-			break
+			return ErrStopTimeout
 		}
 	}
 	return nil
@@ -207,22 +312,71 @@ func getStopTimeout() time.Duration {
 func (windows *windowsRecord) Status() (string, error) {
 	m, err := mgr.Connect()
 	if err != nil {
-		return "Getting status:" + failed, getWindowsError(err)
+		return "Getting status:" + failed, windows.operationError("status", getWindowsError(err))
 	}
 	defer m.Disconnect()
 	s, err := m.OpenService(windows.name)
 	if err != nil {
-		return "Getting status:" + failed, getWindowsError(err)
+		return "Getting status:" + failed, windows.operationError("status", getWindowsError(err))
 	}
 	defer s.Close()
 	status, err := s.Query()
 	if err != nil {
-		return "Getting status:" + failed, getWindowsError(err)
+		return "Getting status:" + failed, windows.operationError("status", getWindowsError(err))
 	}
 
 	return "Status: " + getWindowsServiceStateFromUint32(status.State), nil
 }
 
+// StatusInfo - Get structured service status
+func (windows *windowsRecord) StatusInfo() (ServiceStatus, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return ServiceStatus{}, windows.operationError("status", getWindowsError(err))
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(windows.name)
+	if err != nil {
+		if err == syscall.Errno(1060) { // ERROR_SERVICE_DOES_NOT_EXIST
+			return ServiceStatus{State: StateNotInstalled, Backend: "windows"}, nil
+		}
+		return ServiceStatus{}, windows.operationError("status", getWindowsError(err))
+	}
+	defer s.Close()
+	status, err := s.Query()
+	if err != nil {
+		return ServiceStatus{}, windows.operationError("status", getWindowsError(err))
+	}
+
+	info := ServiceStatus{State: StateStopped, PID: int(status.ProcessId), Backend: "windows"}
+	switch status.State {
+	case svc.StartPending, svc.ContinuePending:
+		info.State = StateStarting
+	case svc.Running, svc.StopPending, svc.PausePending, svc.Paused:
+		info.State = StateRunning
+	}
+
+	return info, nil
+}
+
+// Watch - Watch the service status
+func (windows *windowsRecord) Watch(ctx context.Context) (<-chan StatusEvent, error) {
+	if _, err := windows.StatusInfo(); err != nil {
+		return nil, err
+	}
+
+	return watchStatus(ctx, func() ServiceStatus {
+		status, _ := windows.StatusInfo()
+		return status
+	}, nil), nil
+}
+
+// Logs - Read the service log, the output of the windows services is not
+// kept by the service manager
+func (windows *windowsRecord) Logs(opts LogOptions) (io.ReadCloser, error) {
+	return nil, windows.operationError("logs", ErrUnsupported)
+}
+
 // Get executable path
 func execPath() (string, error) {
 	var n uint32
@@ -246,7 +400,7 @@ func getWindowsError(inputError error) error {
 	if exiterr, ok := inputError.(*exec.ExitError); ok {
 		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
 			if sysErr, ok := WinErrCode[status.ExitStatus()]; ok {
-				return errors.New(fmt.Sprintf("\n %s: %s \n %s", sysErr.Title, sysErr.Description, sysErr.Action))
+				return fmt.Errorf("\n %s: %s \n %s: %w", sysErr.Title, sysErr.Description, sysErr.Action, inputError)
 			}
 		}
 	}
@@ -276,25 +430,53 @@ func getWindowsServiceStateFromUint32(state svc.State) string {
 }
 
 type serviceHandler struct {
-	executable Executable
+	executable  ExecutableContext
+	stopTimeout time.Duration
+	err         error
 }
 
 func (sh *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue | svc.AcceptParamChange
 	changes <- svc.Status{State: svc.StartPending}
 
 	fasttick := time.Tick(500 * time.Millisecond)
 	slowtick := time.Tick(2 * time.Second)
 	tick := fasttick
 
-	sh.executable.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the service specific error code makes the service manager
+	// to take the recovery actions
+	if sh.err = sh.executable.Start(ctx); sh.err != nil {
+		return true, 1
+	}
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
+	// the executable whose work is finished is stopped as by the stop request
+	var finished <-chan struct{}
+	if finisher, ok := sh.executable.(Finisher); ok {
+		finished = finisher.Done()
+	}
+	stop := func() (bool, uint32) {
+		changes <- svc.Status{State: svc.StopPending}
+		cancel()
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), sh.stopTimeout)
+		sh.err = sh.executable.Stop(stopCtx)
+		stopCancel()
+		if sh.err != nil {
+			return true, 1
+		}
+		return false, 0
+	}
+
 loop:
 	for {
 		select {
 		case <-tick:
 			break
+		case <-finished:
+			return stop()
 		case c := <-r:
 			switch c.Cmd {
 			case svc.Interrogate:
@@ -303,9 +485,12 @@ loop:
 				time.Sleep(100 * time.Millisecond)
 				changes <- c.CurrentStatus
 			case svc.Stop, svc.Shutdown:
-				changes <- svc.Status{State: svc.StopPending}
-				sh.executable.Stop()
-				break loop
+				return stop()
+			case svc.ParamChange:
+				if reloader, ok := sh.executable.(ReloaderContext); ok {
+					reloader.Reload(ctx)
+				}
+				changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 			case svc.Pause:
 				changes <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
 				tick = slowtick
@@ -317,24 +502,40 @@ loop:
 			}
 		}
 	}
-	return
+}
+
+// Run the executable by the windows service manager
+func (windows *windowsRecord) runService(e ExecutableContext) error {
+	stopTimeout := windows.config.stopTimeout
+	if stopTimeout <= 0 {
+		stopTimeout = defaultStopTimeout
+	}
+
+	handler := &serviceHandler{
+		executable:  e,
+		stopTimeout: stopTimeout,
+	}
+	if err := svc.Run(windows.name, handler); err != nil {
+		return getWindowsError(err)
+	}
+	return handler.err
 }
 
 func (windows *windowsRecord) Run(e Executable) (string, error) {
 	runAction := "Running " + windows.description + ":"
+	if err := windows.config.startLog(windows.name); err != nil {
+		return runAction + failed, windows.operationError("run", err)
+	}
 
 	interactive, err := svc.IsAnInteractiveSession()
 	if err != nil {
-		return runAction + failed, getWindowsError(err)
+		return runAction + failed, windows.operationError("run", getWindowsError(err))
 	}
 	if !interactive {
 		// service called from windows service manager
 		// use API provided by golang.org/x/sys/windows
-		err = svc.Run(windows.name, &serviceHandler{
-			executable: e,
-		})
-		if err != nil {
-			return runAction + failed, getWindowsError(err)
+		if err := windows.runService(&executableAdapter{e}); err != nil {
+			return runAction + failed, windows.operationError("run", err)
 		}
 	} else {
 		// otherwise, service should be called from terminal session
@@ -344,6 +545,30 @@ func (windows *windowsRecord) Run(e Executable) (string, error) {
 	return runAction + " completed.", nil
 }
 
+// RunContext - Run context-aware service
+func (windows *windowsRecord) RunContext(e ExecutableContext) (string, error) {
+	runAction := "Running " + windows.description + ":"
+	if err := windows.config.startLog(windows.name); err != nil {
+		return runAction + failed, windows.operationError("run", err)
+	}
+
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return runAction + failed, windows.operationError("run", getWindowsError(err))
+	}
+	if !interactive {
+		err = windows.runService(e)
+	} else {
+		// in terminal session the service is stopped by Ctrl+C
+		err = runExecutable(windows.description, e, windows.config.stopTimeout)
+	}
+	if err != nil {
+		return runAction + failed, windows.operationError("run", err)
+	}
+
+	return runAction + " completed.", nil
+}
+
 // GetTemplate - gets service config template
 func (linux *windowsRecord) GetTemplate() string {
 	return ""
@@ -351,5 +576,5 @@ func (linux *windowsRecord) GetTemplate() string {
 
 // SetTemplate - sets service config template
 func (linux *windowsRecord) SetTemplate(tplStr string) error {
-	return errors.New(fmt.Sprintf("templating is not supported for windows"))
+	return fmt.Errorf("templating is not supported for windows: %w", ErrUnsupported)
 }
@@ -0,0 +1,148 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Umask of the daemonized process
+const daemonizeUmask = 022
+
+// Daemonize starts the program again with the arguments detached from the
+// terminal and the parent process: in a new session, with the standard input
+// from /dev/null, the output appended to /var/log/<name>.log and .err, the
+// umask 022 and "/" as the working directory. The pid of the started process
+// is written to /var/run/<name>.pid and returned.
+func Daemonize(name string, args ...string) (int, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	return daemonize(config{}, name, path, args)
+}
+
+// Start the program detached, the user, the group, the working directory and
+// the environment of the service are taken from the config, the log files
+// and the pid file are created in its alternate root directory
+func daemonize(cfg config, name, path string, args []string) (int, error) {
+	for _, dir := range []string{"/var/run", "/var/log"} {
+		if err := os.MkdirAll(cfg.path(dir), 0755); err != nil {
+			return 0, err
+		}
+	}
+
+	stdout, err := os.OpenFile(cfg.path("/var/log/"+name+".log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer stdout.Close()
+
+	stderr, err := os.OpenFile(cfg.path("/var/log/"+name+".err"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer stderr.Close()
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Dir = "/"
+	if cfg.workDir != "" {
+		cmd.Dir = cfg.workDir
+	}
+	cmd.Env = append(os.Environ(), cfg.env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if cfg.user != "" || cfg.group != "" {
+		credential, err := daemonCredential(cfg.user, cfg.group)
+		if err != nil {
+			return 0, err
+		}
+		cmd.SysProcAttr.Credential = credential
+	}
+
+	// the umask is inherited by the started process
+	umask := syscall.Umask(daemonizeUmask)
+	err = cmd.Start()
+	syscall.Umask(umask)
+	if err != nil {
+		return 0, err
+	}
+
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	if err := ioutil.WriteFile(cfg.pidFile(name), []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		return pid, err
+	}
+
+	return pid, nil
+}
+
+// Get the credential of the user and the group the service runs as, the
+// primary group of the user by default
+func daemonCredential(userName, groupName string) (*syscall.Credential, error) {
+	credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		credential.Uid, credential.Gid = uint32(uid), uint32(gid)
+	}
+
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		credential.Gid = uint32(gid)
+	}
+
+	return credential, nil
+}
+
+// Send SIGTERM to the process and wait until it exits, the process is killed
+// if it does not exit within the timeout
+func terminateProcess(pid int, timeout time.Duration) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDaemonizeRoot(t *testing.T) {
+	path, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true is not found")
+	}
+
+	root := t.TempDir()
+	cfg := config{root: root}
+	pid, err := daemonize(cfg, "test", path, nil)
+	if err != nil {
+		t.Fatalf("daemonize() error = %v", err)
+	}
+	if pid <= 0 {
+		t.Errorf("daemonize() pid = %d", pid)
+	}
+
+	// the files are created in the alternate root directory
+	for _, name := range []string{"/var/run/test.pid", "/var/log/test.log", "/var/log/test.err"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if got := readPidFile(cfg.pidFile("test")); got != 0 && got != pid {
+		t.Errorf("readPidFile() = %d; want %d", got, pid)
+	}
+}
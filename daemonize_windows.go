@@ -0,0 +1,11 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+// Daemonize starts the program again detached from the terminal, the windows
+// services are started by the service manager only
+func Daemonize(name string, args ...string) (int, error) {
+	return 0, ErrUnsupportedSystem
+}
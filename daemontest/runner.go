@@ -0,0 +1,149 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package daemontest provides utilities for testing of the services managed
+// by the daemon package without touching the service manager of the host.
+package daemontest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/takama/daemon"
+)
+
+// Runner is a daemon.CommandRunner which records the commands instead of
+// running them and returns the results set by On. It is safe for concurrent
+// use.
+//
+//	runner := &daemontest.Runner{}
+//	runner.On("systemctl show", "ActiveState=failed\nExecMainStatus=1\n", nil)
+//	service, err := daemon.NewWithOptions(name, description,
+//		daemon.SystemDaemon, daemon.WithRunner(runner))
+type Runner struct {
+	mu       sync.Mutex
+	commands [][]string
+	results  []result
+}
+
+// result of the commands which start with the words of the prefix
+type result struct {
+	prefix []string
+	output []byte
+	err    error
+}
+
+var _ daemon.StreamRunner = (*Runner)(nil)
+
+// On sets output and error returned for the commands which start with the
+// given words, e.g. "systemctl status" matches "systemctl status name.service".
+// If several results match the command, the longest prefix wins. The commands
+// without a result succeed with empty output.
+func (runner *Runner) On(command, output string, err error) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	runner.results = append(runner.results, result{strings.Fields(command), []byte(output), err})
+}
+
+// Run records the command and returns the result set by On
+func (runner *Runner) Run(name string, args ...string) ([]byte, error) {
+	return runner.run(name, args)
+}
+
+// Stream records the command and returns the reader of the output set by On,
+// e.g. for the followed log
+func (runner *Runner) Stream(name string, args ...string) (io.ReadCloser, error) {
+	output, err := runner.run(name, args)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(output)), nil
+}
+
+// Record the command and get its result
+func (runner *Runner) run(name string, args []string) ([]byte, error) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	command := append([]string{name}, args...)
+	runner.commands = append(runner.commands, command)
+
+	var match *result
+	for i := range runner.results {
+		r := &runner.results[i]
+		if hasPrefix(command, r.prefix) && (match == nil || len(r.prefix) >= len(match.prefix)) {
+			match = r
+		}
+	}
+	if match == nil {
+		return nil, nil
+	}
+
+	return match.output, match.err
+}
+
+// Commands returns the recorded commands, each one is the command name
+// followed by its arguments
+func (runner *Runner) Commands() [][]string {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	commands := make([][]string, len(runner.commands))
+	copy(commands, runner.commands)
+
+	return commands
+}
+
+// CommandLines returns the recorded commands joined by spaces, which is
+// convenient for comparison with the expected commands
+func (runner *Runner) CommandLines() []string {
+	var lines []string
+	for _, command := range runner.Commands() {
+		lines = append(lines, strings.Join(command, " "))
+	}
+
+	return lines
+}
+
+// Reset forgets the recorded commands, the results set by On are kept
+func (runner *Runner) Reset() {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+
+	runner.commands = nil
+}
+
+// ExitError is returned by Run to simulate the command which exits with
+// non-zero code
+type ExitError struct {
+	Code int
+}
+
+// Error describes the exit code
+func (e *ExitError) Error() string {
+	return "exit status " + strconv.Itoa(e.Code)
+}
+
+// ExitCode returns the exit code of the command
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Is the command prefixed by the words
+func hasPrefix(command, prefix []string) bool {
+	if len(prefix) > len(command) {
+		return false
+	}
+	for i := range prefix {
+		if command[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,758 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of the D-Bus messages
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusErrorReply   = 3
+	dbusSignal       = 4
+)
+
+// Codes of the D-Bus message header fields
+const (
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSender      = 7
+	dbusFieldSignature   = 8
+)
+
+// Maximal length of the D-Bus message, the messages are much smaller
+const dbusMaxMessageLength = 1 << 27
+
+// errDBusMessage appears if the D-Bus message can not be encoded or decoded
+var errDBusMessage = errors.New("Invalid D-Bus message")
+
+// DBusError is the error returned by the D-Bus service for the method call
+type DBusError struct {
+	// Name of the error, e.g. "org.freedesktop.systemd1.NoSuchUnit"
+	Name string
+
+	// Message - description of the error
+	Message string
+}
+
+// Error - name and description of the error
+func (e *DBusError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// dbusMessage - the D-Bus message, the body values are strings (for s, o
+// and g types), bool, byte, integers, float64, []interface{} (for arrays
+// and structs) and dbusVariant
+type dbusMessage struct {
+	Type        byte
+	Flags       byte
+	Serial      uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []interface{}
+}
+
+// dbusVariant - the value with its signature
+type dbusVariant struct {
+	Signature string
+	Value     interface{}
+}
+
+// dbusEncoder - encoder of the values in the little endian D-Bus format
+type dbusEncoder struct {
+	buf []byte
+}
+
+// Add the padding for the alignment of the next value
+func (e *dbusEncoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// Encode the values of the signature
+func (e *dbusEncoder) values(signature string, values []interface{}) error {
+	for _, value := range values {
+		sig, rest, err := dbusNextType(signature)
+		if err != nil {
+			return err
+		}
+		if err := e.value(sig, value); err != nil {
+			return err
+		}
+		signature = rest
+	}
+	if signature != "" {
+		return errDBusMessage
+	}
+	return nil
+}
+
+// Encode the value of the single complete type
+func (e *dbusEncoder) value(sig string, value interface{}) error {
+	switch sig[0] {
+	case 'y':
+		v, ok := value.(byte)
+		if !ok {
+			return errDBusMessage
+		}
+		e.buf = append(e.buf, v)
+	case 'b':
+		v, ok := value.(bool)
+		if !ok {
+			return errDBusMessage
+		}
+		var u uint32
+		if v {
+			u = 1
+		}
+		e.uint32(u)
+	case 'u':
+		v, ok := value.(uint32)
+		if !ok {
+			return errDBusMessage
+		}
+		e.uint32(v)
+	case 'i':
+		v, ok := value.(int32)
+		if !ok {
+			return errDBusMessage
+		}
+		e.uint32(uint32(v))
+	case 't':
+		v, ok := value.(uint64)
+		if !ok {
+			return errDBusMessage
+		}
+		e.align(8)
+		e.buf = append(e.buf, make([]byte, 8)...)
+		binary.LittleEndian.PutUint64(e.buf[len(e.buf)-8:], v)
+	case 's', 'o':
+		v, ok := value.(string)
+		if !ok {
+			return errDBusMessage
+		}
+		e.uint32(uint32(len(v)))
+		e.buf = append(e.buf, v...)
+		e.buf = append(e.buf, 0)
+	case 'g':
+		v, ok := value.(string)
+		if !ok || len(v) > 255 {
+			return errDBusMessage
+		}
+		e.signature(v)
+	case 'v':
+		v, ok := value.(dbusVariant)
+		if !ok {
+			return errDBusMessage
+		}
+		e.signature(v.Signature)
+		return e.value(v.Signature, v.Value)
+	case 'a':
+		e.uint32(0)
+		lengthPos := len(e.buf) - 4
+		e.align(dbusAlignment(sig[1]))
+		start := len(e.buf)
+		switch v := value.(type) {
+		case []string:
+			for _, item := range v {
+				if err := e.value(sig[1:], item); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				if err := e.value(sig[1:], item); err != nil {
+					return err
+				}
+			}
+		default:
+			return errDBusMessage
+		}
+		binary.LittleEndian.PutUint32(e.buf[lengthPos:], uint32(len(e.buf)-start))
+	case '(':
+		v, ok := value.([]interface{})
+		if !ok {
+			return errDBusMessage
+		}
+		e.align(8)
+		return e.values(sig[1:len(sig)-1], v)
+	default:
+		return errDBusMessage
+	}
+	return nil
+}
+
+// Encode the unsigned integer
+func (e *dbusEncoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+// Encode the signature
+func (e *dbusEncoder) signature(s string) {
+	e.buf = append(e.buf, byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// dbusDecoder - decoder of the values in the D-Bus format
+type dbusDecoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+// Skip the padding before the aligned value
+func (d *dbusDecoder) align(n int) error {
+	pos := (d.pos + n - 1) / n * n
+	if pos > len(d.buf) {
+		return errDBusMessage
+	}
+	d.pos = pos
+	return nil
+}
+
+// Get the next bytes of the buffer
+func (d *dbusDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.buf) {
+		return nil, errDBusMessage
+	}
+	data := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return data, nil
+}
+
+// Decode the values of the signature
+func (d *dbusDecoder) values(signature string) ([]interface{}, error) {
+	var values []interface{}
+	for signature != "" {
+		sig, rest, err := dbusNextType(signature)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.value(sig)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		signature = rest
+	}
+	return values, nil
+}
+
+// Decode the value of the single complete type
+func (d *dbusDecoder) value(sig string) (interface{}, error) {
+	if err := d.align(dbusAlignment(sig[0])); err != nil {
+		return nil, err
+	}
+
+	switch sig[0] {
+	case 'y':
+		data, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return data[0], nil
+	case 'b':
+		data, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint32(data) != 0, nil
+	case 'n':
+		data, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		return int16(d.order.Uint16(data)), nil
+	case 'q':
+		data, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint16(data), nil
+	case 'i':
+		data, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return int32(d.order.Uint32(data)), nil
+	case 'u', 'h':
+		data, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint32(data), nil
+	case 'x':
+		data, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return int64(d.order.Uint64(data)), nil
+	case 't':
+		data, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return d.order.Uint64(data), nil
+	case 'd':
+		data, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(d.order.Uint64(data)), nil
+	case 's', 'o':
+		data, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		data, err = d.next(int(d.order.Uint32(data)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(data[:len(data)-1]), nil
+	case 'g':
+		return d.signature()
+	case 'v':
+		signature, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		sig, rest, err := dbusNextType(signature)
+		if err != nil || rest != "" {
+			return nil, errDBusMessage
+		}
+		value, err := d.value(sig)
+		if err != nil {
+			return nil, err
+		}
+		return dbusVariant{Signature: sig, Value: value}, nil
+	case 'a':
+		data, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		length := int(d.order.Uint32(data))
+		if err := d.align(dbusAlignment(sig[1])); err != nil {
+			return nil, err
+		}
+		end := d.pos + length
+		if end > len(d.buf) {
+			return nil, errDBusMessage
+		}
+		items := []interface{}{}
+		for d.pos < end {
+			item, err := d.value(sig[1:])
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case '(', '{':
+		return d.values(sig[1 : len(sig)-1])
+	}
+	return nil, errDBusMessage
+}
+
+// Decode the signature
+func (d *dbusDecoder) signature() (string, error) {
+	data, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	data, err = d.next(int(data[0]) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(data[:len(data)-1]), nil
+}
+
+// Split the signature into the first complete type and the rest
+func dbusNextType(signature string) (string, string, error) {
+	return dbusSplitType(signature, false)
+}
+
+// Split the signature into the first complete type and the rest, the dict
+// entry is allowed as the item of the array only
+func dbusSplitType(signature string, item bool) (string, string, error) {
+	if signature == "" {
+		return "", "", errDBusMessage
+	}
+
+	switch signature[0] {
+	case 'a':
+		sig, rest, err := dbusSplitType(signature[1:], true)
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + sig, rest, nil
+	case '(', '{':
+		if signature[0] == '{' && !item {
+			return "", "", errDBusMessage
+		}
+		closing := map[byte]byte{'(': ')', '{': '}'}[signature[0]]
+		rest := signature[1:]
+		var fields []string
+		for rest != "" && rest[0] != closing {
+			var sig string
+			var err error
+			if sig, rest, err = dbusSplitType(rest, false); err != nil {
+				return "", "", err
+			}
+			fields = append(fields, sig)
+		}
+		// the empty structs are not allowed, the dict entries have
+		// the basic key and the value
+		if rest == "" || len(fields) == 0 ||
+			closing == '}' && (len(fields) != 2 || !dbusBasicType(fields[0])) {
+			return "", "", errDBusMessage
+		}
+		n := len(signature) - len(rest) + 1
+		return signature[:n], signature[n:], nil
+	case 'y', 'b', 'n', 'q', 'i', 'u', 'x', 't', 'd', 'h', 's', 'o', 'g', 'v':
+		return signature[:1], signature[1:], nil
+	}
+
+	return "", "", errDBusMessage
+}
+
+// Is the type basic, the keys of the dict entries are basic
+func dbusBasicType(sig string) bool {
+	return len(sig) == 1 && sig != "v"
+}
+
+// Get the alignment of the type
+func dbusAlignment(code byte) int {
+	switch code {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 1
+}
+
+// Encode the message
+func (m *dbusMessage) encode() ([]byte, error) {
+	var body dbusEncoder
+	if err := body.values(m.Signature, m.Body); err != nil {
+		return nil, err
+	}
+
+	var fields []interface{}
+	field := func(code byte, sig, value string) {
+		if value != "" {
+			fields = append(fields, []interface{}{code, dbusVariant{Signature: sig, Value: value}})
+		}
+	}
+	field(dbusFieldPath, "o", m.Path)
+	field(dbusFieldInterface, "s", m.Interface)
+	field(dbusFieldMember, "s", m.Member)
+	field(dbusFieldErrorName, "s", m.ErrorName)
+	field(dbusFieldDestination, "s", m.Destination)
+	field(dbusFieldSender, "s", m.Sender)
+	field(dbusFieldSignature, "g", m.Signature)
+	if m.ReplySerial != 0 {
+		fields = append(fields, []interface{}{
+			byte(dbusFieldReplySerial), dbusVariant{Signature: "u", Value: m.ReplySerial},
+		})
+	}
+
+	e := dbusEncoder{buf: []byte{'l', m.Type, m.Flags, 1}}
+	e.uint32(uint32(len(body.buf)))
+	e.uint32(m.Serial)
+	if err := e.value("a(yv)", fields); err != nil {
+		return nil, err
+	}
+	e.align(8)
+
+	return append(e.buf, body.buf...), nil
+}
+
+// Read the message
+func readDBusMessage(r io.Reader) (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, errDBusMessage
+	}
+
+	bodyLength := int(order.Uint32(fixed[4:]))
+	fieldsLength := int(order.Uint32(fixed[12:]))
+	headerLength := (16 + fieldsLength + 7) / 8 * 8
+	if bodyLength > dbusMaxMessageLength || fieldsLength > dbusMaxMessageLength {
+		return nil, errDBusMessage
+	}
+
+	buf := make([]byte, headerLength+bodyLength)
+	copy(buf, fixed)
+	if _, err := io.ReadFull(r, buf[16:]); err != nil {
+		return nil, err
+	}
+
+	m := &dbusMessage{Type: fixed[1], Flags: fixed[2], Serial: order.Uint32(fixed[8:])}
+
+	d := &dbusDecoder{buf: buf[:16+fieldsLength], pos: 12, order: order}
+	fields, err := d.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range fields.([]interface{}) {
+		f := item.([]interface{})
+		value := f[1].(dbusVariant).Value
+		switch f[0].(byte) {
+		case dbusFieldPath:
+			m.Path, _ = value.(string)
+		case dbusFieldInterface:
+			m.Interface, _ = value.(string)
+		case dbusFieldMember:
+			m.Member, _ = value.(string)
+		case dbusFieldErrorName:
+			m.ErrorName, _ = value.(string)
+		case dbusFieldReplySerial:
+			m.ReplySerial, _ = value.(uint32)
+		case dbusFieldDestination:
+			m.Destination, _ = value.(string)
+		case dbusFieldSender:
+			m.Sender, _ = value.(string)
+		case dbusFieldSignature:
+			m.Signature, _ = value.(string)
+		}
+	}
+
+	// the alignment of the body values is relative to the message start
+	d = &dbusDecoder{buf: buf, pos: headerLength, order: order}
+	if m.Body, err = d.values(m.Signature); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// dbusConn - connection to the D-Bus message bus
+type dbusConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	serial  uint32
+	signals []*dbusMessage
+}
+
+// Connect to the message bus at the address, e.g.
+// "unix:path=/run/dbus/system_bus_socket", authenticated as the
+// current user
+func dialDBus(address string) (*dbusConn, error) {
+	var conn net.Conn
+	var err error = errors.New("Unsupported D-Bus address: " + address)
+	for _, transport := range strings.Split(address, ";") {
+		if !strings.HasPrefix(transport, "unix:") {
+			continue
+		}
+		for _, param := range strings.Split(strings.TrimPrefix(transport, "unix:"), ",") {
+			switch {
+			case strings.HasPrefix(param, "path="):
+				conn, err = net.Dial("unix", dbusUnescape(strings.TrimPrefix(param, "path=")))
+			case strings.HasPrefix(param, "abstract="):
+				conn, err = net.Dial("unix", "@"+dbusUnescape(strings.TrimPrefix(param, "abstract=")))
+			}
+		}
+		if conn != nil {
+			break
+		}
+	}
+	if conn == nil {
+		return nil, err
+	}
+
+	c := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := c.auth(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus",
+		"org.freedesktop.DBus", "Hello", ""); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Unescape the value of the D-Bus address
+func dbusUnescape(value string) string {
+	var result []byte
+	for i := 0; i < len(value); i++ {
+		if value[i] == '%' && i+2 < len(value) {
+			if b, err := hex.DecodeString(value[i+1 : i+3]); err == nil {
+				result = append(result, b...)
+				i += 2
+				continue
+			}
+		}
+		result = append(result, value[i])
+	}
+	return string(result)
+}
+
+// Authenticate by the credentials of the process (EXTERNAL mechanism)
+func (c *dbusConn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return errors.New("D-Bus authentication failed: " + strings.TrimSpace(line))
+	}
+
+	_, err = io.WriteString(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// Send the message with the next serial
+func (c *dbusConn) send(m *dbusMessage) error {
+	c.serial++
+	m.Serial = c.serial
+
+	data, err := m.encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// Call the method and wait for its reply, the signals received meanwhile
+// are kept for waitSignal
+func (c *dbusConn) call(destination, path, iface, member, signature string, args ...interface{}) ([]interface{}, error) {
+	m := &dbusMessage{
+		Type:        dbusMethodCall,
+		Destination: destination,
+		Path:        path,
+		Interface:   iface,
+		Member:      member,
+		Signature:   signature,
+		Body:        args,
+	}
+	if err := c.send(m); err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := readDBusMessage(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case reply.Type == dbusSignal:
+			c.signals = append(c.signals, reply)
+		case reply.ReplySerial != m.Serial:
+			continue
+		case reply.Type == dbusErrorReply:
+			e := &DBusError{Name: reply.ErrorName}
+			if len(reply.Body) > 0 {
+				e.Message, _ = reply.Body[0].(string)
+			}
+			return nil, e
+		case reply.Type == dbusMethodReturn:
+			return reply.Body, nil
+		}
+	}
+}
+
+// Wait for the signal accepted by the match function until the deadline,
+// without the deadline if it is zero
+func (c *dbusConn) waitSignal(match func(*dbusMessage) bool, deadline time.Time) (*dbusMessage, error) {
+	for i, signal := range c.signals {
+		if match(signal) {
+			c.signals = append(c.signals[:i], c.signals[i+1:]...)
+			return signal, nil
+		}
+	}
+
+	if !deadline.IsZero() {
+		if err := c.conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		defer c.conn.SetReadDeadline(time.Time{})
+	}
+
+	for {
+		m, err := readDBusMessage(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if m.Type == dbusSignal && match(m) {
+			return m, nil
+		}
+	}
+}
+
+// Close the connection
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
+
+// Format the value of the D-Bus property as systemctl does
+func formatDBusValue(value interface{}) string {
+	switch v := value.(type) {
+	case dbusVariant:
+		return formatDBusValue(v.Value)
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case string:
+		return v
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,343 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the systemd manager on the bus
+const (
+	systemDBusName    = "org.freedesktop.systemd1"
+	systemDBusPath    = "/org/freedesktop/systemd1"
+	systemDBusManager = "org.freedesktop.systemd1.Manager"
+	systemDBusUnit    = "org.freedesktop.systemd1.Unit"
+	systemDBusService = "org.freedesktop.systemd1.Service"
+)
+
+// Properties of the service units, the others belong to the units
+var systemDBusServiceProperties = map[string]bool{
+	"MainPID":        true,
+	"ExecMainStatus": true,
+	"NRestarts":      true,
+}
+
+// Methods of the manager changing the state of the units
+var systemDBusJobs = map[string]string{
+	"start":   "StartUnit",
+	"stop":    "StopUnit",
+	"restart": "RestartUnit",
+	"reload":  "ReloadUnit",
+}
+
+// dbusRunner - runner of the systemctl commands which calls the methods
+// of systemd over D-Bus instead of running systemctl, the other commands
+// and the commands it does not know are run by the fallback runner
+type dbusRunner struct {
+	address  string
+	timeout  time.Duration
+	fallback CommandRunner
+
+	mu    sync.Mutex
+	conns map[bool]*dbusConn
+}
+
+// Create the runner sending the commands to the bus at the address, the
+// system bus (or the bus of the user for "systemctl --user") by default. The
+// jobs are waited for the timeout at most.
+func newDBusRunner(address string, timeout time.Duration, fallback CommandRunner) *dbusRunner {
+	return &dbusRunner{address: address, timeout: timeout, fallback: fallback, conns: make(map[bool]*dbusConn)}
+}
+
+// Stream - start the command by the fallback runner, systemd does not stream
+// the output of the commands over D-Bus
+func (r *dbusRunner) Stream(name string, args ...string) (io.ReadCloser, error) {
+	return streamCommand(r.fallback, name, args...)
+}
+
+// Run the command
+func (r *dbusRunner) Run(name string, args ...string) ([]byte, error) {
+	if name != "systemctl" {
+		return r.fallback.Run(name, args...)
+	}
+
+	var user bool
+	var command []string
+	for _, arg := range args {
+		switch {
+		case arg == "--user":
+			user = true
+		case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--property="):
+			// the unit files in the alternate root and other
+			// options are handled by systemctl
+			return r.fallback.Run(name, args...)
+		default:
+			command = append(command, arg)
+		}
+	}
+	if len(command) == 0 {
+		return r.fallback.Run(name, args...)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conn, err := r.connect(user)
+	if err != nil {
+		return nil, err
+	}
+
+	output, ok, err := r.run(conn, command[0], command[1:])
+	if !ok {
+		return r.fallback.Run(name, args...)
+	}
+
+	// the connection is dropped if it is broken, the errors of the
+	// methods do not break it
+	var dbusErr *DBusError
+	if err != nil && !errors.As(err, &dbusErr) {
+		conn.Close()
+		delete(r.conns, user)
+	}
+
+	return output, err
+}
+
+// Get the connection to the system or the user bus, the manager sends
+// the signals about the finished jobs to the connection. The connection
+// belongs to the runner and is used by one command at a time, Watch has
+// its own connection.
+func (r *dbusRunner) connect(user bool) (*dbusConn, error) {
+	if conn, ok := r.conns[user]; ok {
+		return conn, nil
+	}
+
+	conn, err := dialSystemDBus(r.address, user,
+		"type='signal',interface='"+systemDBusManager+"',member='JobRemoved'")
+	if err != nil {
+		return nil, err
+	}
+
+	r.conns[user] = conn
+	return conn, nil
+}
+
+// Connect to the bus of systemd at the address, the system bus (or the bus
+// of the user) by default, and subscribe to the signals of the match rule,
+// if it is given
+func dialSystemDBus(address string, user bool, match string) (*dbusConn, error) {
+	if address == "" && user {
+		address = os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+		if address == "" {
+			address = "unix:path=" + os.Getenv("XDG_RUNTIME_DIR") + "/bus"
+		}
+	}
+	if address == "" {
+		address = os.Getenv("DBUS_SYSTEM_BUS_ADDRESS")
+		if address == "" {
+			address = "unix:path=/run/dbus/system_bus_socket"
+		}
+	}
+
+	conn, err := dialDBus(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if match != "" {
+		if _, err := conn.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+			"AddMatch", "s", match); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	// systemd sends the signals only to the subscribed clients
+	if _, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, "Subscribe", ""); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Watch the changes of the unit properties (PropertiesChanged signals),
+// the channel receives a value after the changes and is closed when the
+// context is done or the connection is lost, nil if D-Bus is not available
+func watchSystemDUnit(ctx context.Context, address string, user bool, unit string) <-chan struct{} {
+	conn, err := dialSystemDBus(address, user, "")
+	if err != nil {
+		return nil
+	}
+
+	// the object path of the unit is needed for the match rule
+	reply, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, "LoadUnit", "s", unit)
+	if err != nil || len(reply) != 1 {
+		conn.Close()
+		return nil
+	}
+	path, _ := reply[0].(string)
+
+	if _, err := conn.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus",
+		"AddMatch", "s", "type='signal',interface='org.freedesktop.DBus.Properties',"+
+			"member='PropertiesChanged',path='"+path+"'"); err != nil {
+		conn.Close()
+		return nil
+	}
+
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		defer close(changed)
+		for {
+			_, err := conn.waitSignal(func(m *dbusMessage) bool {
+				return m.Member == "PropertiesChanged" && m.Path == path
+			}, time.Time{})
+			if err != nil {
+				return
+			}
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changed
+}
+
+// Run the systemctl command by the methods of the manager, false if the
+// command is not known
+func (r *dbusRunner) run(conn *dbusConn, command string, args []string) ([]byte, bool, error) {
+	switch command {
+	case "daemon-reload":
+		_, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, "Reload", "")
+		return nil, true, err
+	case "start", "stop", "restart", "reload":
+		for _, unit := range args {
+			if err := r.job(conn, systemDBusJobs[command], unit); err != nil {
+				return nil, true, err
+			}
+		}
+		return nil, true, nil
+	case "enable":
+		// systemctl reloads the manager after the change of the unit files
+		if _, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager,
+			"EnableUnitFiles", "asbb", args, false, false); err != nil {
+			return nil, true, err
+		}
+		_, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, "Reload", "")
+		return nil, true, err
+	case "disable":
+		if _, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager,
+			"DisableUnitFiles", "asb", args, false); err != nil {
+			return nil, true, err
+		}
+		_, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, "Reload", "")
+		return nil, true, err
+	case "show":
+		output, err := r.show(conn, args)
+		return output, true, err
+	}
+	return nil, false, nil
+}
+
+// Run the job changing the state of the unit and wait until it is finished,
+// the job which is not finished in the timeout fails, systemd goes on with it
+func (r *dbusRunner) job(conn *dbusConn, method, unit string) error {
+	// the signal of the job may come before the reply with its path,
+	// the signals of the former jobs are not needed anymore
+	signals := conn.signals[:0]
+	for _, signal := range conn.signals {
+		if signal.Member != "JobRemoved" {
+			signals = append(signals, signal)
+		}
+	}
+	conn.signals = signals
+
+	reply, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, method, "ss", unit, "replace")
+	if err != nil {
+		return err
+	}
+	if len(reply) != 1 {
+		return errDBusMessage
+	}
+	path, _ := reply[0].(string)
+
+	// JobRemoved(u id, o job, s unit, s result)
+	signal, err := conn.waitSignal(func(m *dbusMessage) bool {
+		return m.Member == "JobRemoved" && len(m.Body) == 4 && m.Body[1] == path
+	}, time.Now().Add(r.timeout))
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("Job for %s is not finished in %v: %w", unit, r.timeout, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if result, _ := signal.Body[3].(string); result != "done" {
+		return errors.New("Job for " + unit + " failed with result '" + result + "'")
+	}
+
+	return nil
+}
+
+// Get the properties of the unit in the "systemctl show" format
+func (r *dbusRunner) show(conn *dbusConn, args []string) ([]byte, error) {
+	var properties, units []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--property=") {
+			properties = append(properties, strings.Split(strings.TrimPrefix(arg, "--property="), ",")...)
+		} else {
+			units = append(units, arg)
+		}
+	}
+
+	var output []string
+	for _, unit := range units {
+		reply, err := conn.call(systemDBusName, systemDBusPath, systemDBusManager, "LoadUnit", "s", unit)
+		if err != nil {
+			return nil, err
+		}
+		if len(reply) != 1 {
+			return nil, errDBusMessage
+		}
+		path, _ := reply[0].(string)
+
+		for _, property := range properties {
+			iface := systemDBusUnit
+			if systemDBusServiceProperties[property] {
+				iface = systemDBusService
+			}
+
+			reply, err := conn.call(systemDBusName, path, "org.freedesktop.DBus.Properties",
+				"Get", "ss", iface, property)
+			if err != nil {
+				return nil, err
+			}
+			if len(reply) != 1 {
+				return nil, errDBusMessage
+			}
+
+			output = append(output, property+"="+formatDBusValue(reply[0]))
+		}
+	}
+
+	return []byte(strings.Join(output, "\n") + "\n"), nil
+}
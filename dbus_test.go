@@ -0,0 +1,434 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDBusMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		signature string
+		body      []interface{}
+	}{
+		{"", nil},
+		{"y", []interface{}{byte(7)}},
+		{"b", []interface{}{true}},
+		{"i", []interface{}{int32(-42)}},
+		{"u", []interface{}{uint32(42)}},
+		{"t", []interface{}{uint64(1) << 40}},
+		{"sog", []interface{}{"unit", "/org/freedesktop/systemd1", "a(yv)"}},
+		{"ss", []interface{}{"", "replace"}},
+		{"v", []interface{}{dbusVariant{Signature: "s", Value: "active"}}},
+		{"v", []interface{}{dbusVariant{Signature: "t", Value: uint64(1600000000000000)}}},
+		{"as", []interface{}{[]interface{}{"a.service", "b.socket"}}},
+		{"as", []interface{}{[]interface{}{}}},
+		{"at", []interface{}{[]interface{}{uint64(1), uint64(2)}}},
+		{"asbb", []interface{}{[]interface{}{"a.service"}, false, true}},
+		{"a(ss)", []interface{}{[]interface{}{
+			[]interface{}{"a", "b"},
+			[]interface{}{"c", "d"},
+		}}},
+		{"(yt)s", []interface{}{[]interface{}{byte(1), uint64(2)}, "tail"}},
+		{"uosb", []interface{}{uint32(1), "/org/freedesktop/systemd1/job/1", "a.service", true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.signature, func(t *testing.T) {
+			m := &dbusMessage{
+				Type:      dbusMethodCall,
+				Serial:    7,
+				Path:      "/org/freedesktop/systemd1",
+				Member:    "Test",
+				Signature: test.signature,
+				Body:      test.body,
+			}
+			data, err := m.encode()
+			if err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+
+			decoded, err := readDBusMessage(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("readDBusMessage() error = %v", err)
+			}
+			if decoded.Serial != m.Serial || decoded.Path != m.Path || decoded.Member != m.Member ||
+				decoded.Signature != m.Signature {
+				t.Errorf("header = %+v; want %+v", decoded, m)
+			}
+			if !reflect.DeepEqual(decoded.Body, m.Body) {
+				t.Errorf("body = %#v; want %#v", decoded.Body, m.Body)
+			}
+		})
+	}
+}
+
+func TestDBusEncodeStringArray(t *testing.T) {
+	var e dbusEncoder
+	if err := e.values("as", []interface{}{[]string{"a", "bc"}}); err != nil {
+		t.Fatalf("values() error = %v", err)
+	}
+
+	d := &dbusDecoder{buf: e.buf, order: binary.LittleEndian}
+	values, err := d.values("as")
+	if err != nil {
+		t.Fatalf("values() error = %v", err)
+	}
+	if want := []interface{}{[]interface{}{"a", "bc"}}; !reflect.DeepEqual(values, want) {
+		t.Errorf("values() = %#v; want %#v", values, want)
+	}
+}
+
+func TestDBusInvalidSignature(t *testing.T) {
+	for _, signature := range []string{
+		"()", "a()", "(())", "a{}", "a{s}", "a{sss}", "a{vs}", "a{(s)s}", "{ss}", "(s{ss})",
+		"a", "(", "(s", "a{ss", "z", "s)",
+	} {
+		t.Run(signature, func(t *testing.T) {
+			if _, rest, err := dbusNextType(signature); err == nil && rest == "" {
+				t.Errorf("dbusNextType(%q) succeeded", signature)
+			}
+
+			// 1 MB of the array items of the zero size
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint32(buf, 1<<20)
+			d := &dbusDecoder{buf: buf, order: binary.LittleEndian}
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := d.values(signature)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Errorf("values(%q) succeeded", signature)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("values(%q) does not return", signature)
+			}
+		})
+	}
+}
+
+func TestDBusValidSignature(t *testing.T) {
+	for _, signature := range []string{"a{sv}", "a{ua(ss)}", "a(yv)", "(s(ss))", "aas", "v"} {
+		if sig, rest, err := dbusNextType(signature); err != nil || sig != signature || rest != "" {
+			t.Errorf("dbusNextType(%q) = %q, %q, %v", signature, sig, rest, err)
+		}
+	}
+}
+
+func TestDBusTruncatedMessage(t *testing.T) {
+	m := &dbusMessage{Type: dbusMethodCall, Serial: 1, Member: "Test", Signature: "s", Body: []interface{}{"value"}}
+	data, err := m.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < len(data); n++ {
+		if _, err := readDBusMessage(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("readDBusMessage() of %d bytes succeeded", n)
+		}
+	}
+}
+
+// fakeSystemD - the message bus with systemd served over the unix socket,
+// the units have the properties and the jobs finish with the results
+type fakeSystemD struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu         sync.Mutex
+	calls      []string
+	properties map[string]dbusVariant
+	results    map[string]string
+	dropped    map[string]bool
+	jobs       uint32
+}
+
+// Start the fake bus in the temporary directory
+func startFakeSystemD(t *testing.T) *fakeSystemD {
+	path := filepath.Join(t.TempDir(), "bus")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := &fakeSystemD{
+		t:          t,
+		listener:   listener,
+		properties: make(map[string]dbusVariant),
+		results:    make(map[string]string),
+		dropped:    make(map[string]bool),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go bus.serve(conn)
+		}
+	}()
+
+	return bus
+}
+
+// Address of the bus
+func (bus *fakeSystemD) address() string {
+	return "unix:path=" + bus.listener.Addr().String()
+}
+
+// Methods called on the bus, "Interface.Member args..."
+func (bus *fakeSystemD) methods() []string {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	return append([]string(nil), bus.calls...)
+}
+
+// Serve the connection of the client
+func (bus *fakeSystemD) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// the client sends the null byte before the authentication
+	if b, err := reader.ReadByte(); err != nil || b != 0 {
+		return
+	}
+	if line, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "AUTH EXTERNAL ") {
+		return
+	}
+	conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	if line, err := reader.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	var serial uint32
+	send := func(m *dbusMessage) {
+		serial++
+		m.Serial = serial
+		data, err := m.encode()
+		if err != nil {
+			bus.t.Errorf("encode() error = %v", err)
+			return
+		}
+		conn.Write(data)
+	}
+
+	for {
+		m, err := readDBusMessage(reader)
+		if err != nil {
+			return
+		}
+
+		var args []string
+		for _, value := range m.Body {
+			args = append(args, formatDBusValue(value))
+		}
+		bus.mu.Lock()
+		bus.calls = append(bus.calls, strings.TrimSpace(m.Interface+"."+m.Member+" "+strings.Join(args, " ")))
+		bus.mu.Unlock()
+
+		reply := &dbusMessage{Type: dbusMethodReturn, ReplySerial: m.Serial}
+		switch m.Member {
+		case "Hello":
+			reply.Signature, reply.Body = "s", []interface{}{":1.1"}
+		case "LoadUnit":
+			reply.Signature, reply.Body = "o", []interface{}{"/org/freedesktop/systemd1/unit/" + m.Body[0].(string)}
+		case "Get":
+			bus.mu.Lock()
+			value, ok := bus.properties[m.Body[0].(string)+"."+m.Body[1].(string)]
+			bus.mu.Unlock()
+			if !ok {
+				reply = &dbusMessage{
+					Type:        dbusErrorReply,
+					ReplySerial: m.Serial,
+					ErrorName:   "org.freedesktop.DBus.Error.UnknownProperty",
+					Signature:   "s",
+					Body:        []interface{}{"Unknown property " + m.Body[1].(string)},
+				}
+			} else {
+				reply.Signature, reply.Body = "v", []interface{}{value}
+			}
+		case "StartUnit", "StopUnit":
+			bus.mu.Lock()
+			bus.jobs++
+			job := "/org/freedesktop/systemd1/job/" + strconv.Itoa(int(bus.jobs))
+			result := bus.results[m.Body[0].(string)]
+			dropped := bus.dropped[m.Body[0].(string)]
+			bus.mu.Unlock()
+			if result == "" {
+				result = "done"
+			}
+
+			// systemd may finish the job before the reply is sent, the
+			// signal of the dropped job is never sent
+			if !dropped {
+				send(&dbusMessage{
+					Type:      dbusSignal,
+					Path:      systemDBusPath,
+					Interface: systemDBusManager,
+					Member:    "JobRemoved",
+					Signature: "uoss",
+					Body:      []interface{}{bus.jobs, job, m.Body[0], result},
+				})
+			}
+			reply.Signature, reply.Body = "o", []interface{}{job}
+		}
+		send(reply)
+	}
+}
+
+// fallbackRunner - runner of the commands not sent over the bus
+type fallbackRunner struct {
+	commands []string
+}
+
+func (r *fallbackRunner) Run(name string, args ...string) ([]byte, error) {
+	r.commands = append(r.commands, strings.Join(append([]string{name}, args...), " "))
+	return nil, nil
+}
+
+func TestDBusRunnerJobs(t *testing.T) {
+	bus := startFakeSystemD(t)
+	bus.results["broken.service"] = "failed"
+
+	fallback := &fallbackRunner{}
+	runner := newDBusRunner(bus.address(), time.Second, fallback)
+
+	if _, err := runner.Run("systemctl", "start", "test.socket", "test.service"); err != nil {
+		t.Fatalf("start error = %v", err)
+	}
+	_, err := runner.Run("systemctl", "stop", "broken.service")
+	if err == nil || !strings.Contains(err.Error(), "failed with result 'failed'") {
+		t.Errorf("stop error = %v; want failed job", err)
+	}
+
+	want := []string{
+		"org.freedesktop.DBus.Hello",
+		"org.freedesktop.DBus.AddMatch type='signal',interface='org.freedesktop.systemd1.Manager',member='JobRemoved'",
+		"org.freedesktop.systemd1.Manager.Subscribe",
+		"org.freedesktop.systemd1.Manager.StartUnit test.socket replace",
+		"org.freedesktop.systemd1.Manager.StartUnit test.service replace",
+		"org.freedesktop.systemd1.Manager.StopUnit broken.service replace",
+	}
+	if calls := bus.methods(); !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls:\n%s\nwant:\n%s", strings.Join(calls, "\n"), strings.Join(want, "\n"))
+	}
+
+	// the unit files in the alternate root are managed by systemctl
+	if _, err := runner.Run("systemctl", "--root=/tmp/root", "enable", "test.service"); err != nil {
+		t.Fatalf("enable error = %v", err)
+	}
+	if want := []string{"systemctl --root=/tmp/root enable test.service"}; !reflect.DeepEqual(fallback.commands, want) {
+		t.Errorf("fallback commands = %q; want %q", fallback.commands, want)
+	}
+
+	// the signals of the former jobs are dropped, the other ones are kept
+	if _, err := runner.Run("systemctl", "start", "test.service"); err != nil {
+		t.Fatalf("start error = %v", err)
+	}
+	conn := runner.conns[false]
+	other := &dbusMessage{Type: dbusSignal, Interface: systemDBusManager, Member: "UnitNew"}
+	conn.signals = append(conn.signals, other,
+		&dbusMessage{Type: dbusSignal, Interface: systemDBusManager, Member: "JobRemoved"})
+	if _, err := runner.Run("systemctl", "start", "test.service"); err != nil {
+		t.Fatalf("start error = %v", err)
+	}
+	if len(conn.signals) != 1 || conn.signals[0] != other {
+		t.Errorf("kept signals = %v; want UnitNew", conn.signals)
+	}
+}
+
+func TestDBusRunnerJobTimeout(t *testing.T) {
+	bus := startFakeSystemD(t)
+	bus.dropped["hung.service"] = true
+
+	runner := newDBusRunner(bus.address(), 100*time.Millisecond, &fallbackRunner{})
+
+	started := time.Now()
+	_, err := runner.Run("systemctl", "stop", "hung.service")
+	if err == nil || !strings.Contains(err.Error(), "Job for hung.service is not finished") {
+		t.Fatalf("stop error = %v; want unfinished job", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("stop returned in %v; want the timeout", elapsed)
+	}
+
+	// the connection is dropped, the next job is run on the new one
+	if _, err := runner.Run("systemctl", "start", "test.service"); err != nil {
+		t.Errorf("start after the timeout error = %v", err)
+	}
+	if calls := bus.methods(); len(calls) != 8 || calls[4] != "org.freedesktop.DBus.Hello" {
+		t.Errorf("calls:\n%s\nwant the new connection", strings.Join(calls, "\n"))
+	}
+}
+
+func TestDBusRunnerShow(t *testing.T) {
+	bus := startFakeSystemD(t)
+	// the service has been started an hour ago
+	now, ok := monotonicNow()
+	if !ok {
+		t.Skip("monotonic clock is unknown")
+	}
+	started := uint64((now - time.Hour) / time.Microsecond)
+	since := time.Now().Add(-time.Hour)
+	bus.properties = map[string]dbusVariant{
+		systemDBusUnit + ".ActiveState":                   {Signature: "s", Value: "active"},
+		systemDBusUnit + ".SubState":                      {Signature: "s", Value: "running"},
+		systemDBusService + ".MainPID":                    {Signature: "u", Value: uint32(42)},
+		systemDBusService + ".ExecMainStatus":             {Signature: "i", Value: int32(0)},
+		systemDBusService + ".NRestarts":                  {Signature: "u", Value: uint32(3)},
+		systemDBusUnit + ".ActiveEnterTimestampMonotonic": {Signature: "t", Value: started},
+		systemDBusUnit + ".CanReload":                     {Signature: "b", Value: true},
+	}
+
+	runner := newDBusRunner(bus.address(), time.Second, &fallbackRunner{})
+	output, err := runner.Run("systemctl", "show",
+		"--property="+systemDStatusProperties, "--property=CanReload", "test.service")
+	if err != nil {
+		t.Fatalf("show error = %v", err)
+	}
+
+	want := "ActiveState=active\nSubState=running\nMainPID=42\nExecMainStatus=0\nNRestarts=3\n" +
+		"ActiveEnterTimestampMonotonic=" + strconv.FormatUint(started, 10) + "\n" +
+		"CanReload=yes\n"
+	if string(output) != want {
+		t.Errorf("show output:\n%s\nwant:\n%s", output, want)
+	}
+
+	// the output is parsed by the status of the systemd backend
+	record := &systemDRecord{name: "test", config: config{runner: runner}}
+	status := record.status()
+	if status.State != StateRunning || status.SubState != "running" || status.PID != 42 ||
+		status.Restarts != 3 || status.Since.Sub(since) > time.Second || since.Sub(status.Since) > time.Second {
+		t.Errorf("status = %+v", status)
+	}
+
+	// the errors of the methods are returned and keep the connection
+	_, err = runner.Run("systemctl", "show", "--property=Unknown", "test.service")
+	var dbusErr *DBusError
+	if !errors.As(err, &dbusErr) || dbusErr.Name != "org.freedesktop.DBus.Error.UnknownProperty" {
+		t.Errorf("show error = %v; want DBusError", err)
+	}
+	if _, err := runner.Run("systemctl", "show", "--property=MainPID", "test.service"); err != nil {
+		t.Errorf("show error after the failed method = %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Tools which run the command with root privileges, in order of preference
+var elevationTools = []string{"sudo", "pkexec"}
+
+// elevator is implemented by the services which may re-execute the program
+// with root privileges, see WithElevation
+type elevator interface {
+	elevation() bool
+}
+
+// Is the elevation of the privileges enabled for the service
+func elevationEnabled(d Daemon) bool {
+	e, ok := d.(elevator)
+	return ok && e.elevation()
+}
+
+// Re-execute the program with the arguments through sudo or pkexec, the
+// standard streams are passed to the command, so the password can be asked
+// and the output is shown as is. It returns the exit code of the command.
+func elevate(args []string) (int, error) {
+	// root without the required capabilities gains nothing from sudo
+	if os.Geteuid() == 0 {
+		return exitFailure, ErrRootPrivileges
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return exitFailure, err
+	}
+
+	for _, tool := range elevationTools {
+		path, err := exec.LookPath(tool)
+		if err != nil {
+			continue
+		}
+
+		cmd := exec.Command(path, append([]string{executable}, args...)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			if code := exitStatus(err); code != 0 {
+				return code, nil
+			}
+			return exitFailure, err
+		}
+
+		return exitSuccess, nil
+	}
+
+	return exitFailure, ErrRootPrivileges
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// OperationError records the failed operation of the service and its cause.
+// It wraps the cause, so errors.Is(err, ErrNotInstalled) and errors.As work
+// with the errors returned by the service.
+type OperationError struct {
+	// Op - the operation: install, remove, start, stop, restart, reload,
+	// enable, disable, status, watch, logs or run
+	Op string
+
+	// Backend - the service manager: systemd, upstart, sysv, launchd,
+	// rc.d or windows
+	Backend string
+
+	// Service - name of the service
+	Service string
+
+	// Output - error output of the failed command of the service manager
+	Output string
+
+	// Err - the cause of the failure
+	Err error
+}
+
+// Error - description of the failed operation
+func (e *OperationError) Error() string {
+	text := e.Op + " " + e.Service + " (" + e.Backend + "): " + e.Err.Error()
+	if e.Output != "" {
+		text += ": " + e.Output
+	}
+	return text
+}
+
+// Unwrap - the cause of the failure
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// Create the error of the operation, the errors of the service manager
+// commands keep their output
+func newOperationError(op, backend, service string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var opErr *OperationError
+	if errors.As(err, &opErr) {
+		return err
+	}
+
+	return &OperationError{
+		Op:      op,
+		Backend: backend,
+		Service: service,
+		Output:  commandOutput(err),
+		Err:     err,
+	}
+}
+
+// Get the error output of the failed command
+func commandOutput(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return strings.TrimSpace(string(exitErr.Stderr))
+	}
+	return ""
+}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/robfig/cron"
@@ -20,9 +18,9 @@ const (
 
 var stdlog, errlog *log.Logger
 
-// Service is the daemon service struct
-type Service struct {
-	daemon.Daemon
+// Job is the executable of the service which runs cron jobs
+type Job struct {
+	cron *cron.Cron
 }
 
 func makeFile() {
@@ -34,44 +32,26 @@ func makeFile() {
 	defer f.Close()
 }
 
-// Manage by daemon commands or run the daemon
-func (service *Service) Manage() (string, error) {
-
-	usage := "Usage: cron_job install | remove | start | stop | status"
-	// If received any kind of command, do it
-	if len(os.Args) > 1 {
-		command := os.Args[1]
-		switch command {
-		case "install":
-			return service.Install()
-		case "remove":
-			return service.Remove()
-		case "start":
-			return service.Start()
-		case "stop":
-			// No need to explicitly stop cron since job will be killed
-			return service.Stop()
-		case "status":
-			return service.Status()
-		default:
-			return usage, nil
-		}
-	}
-	// Set up channel on which to send signal notifications.
-	// We must use a buffered channel or risk missing the signal
-	// if we're not ready to receive when the signal is sent.
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, os.Kill, syscall.SIGTERM)
-
+// Start the cron jobs, the daemon calls it when the service starts
+func (job *Job) Start() {
 	// Create a new cron manager
-	c := cron.New()
+	job.cron = cron.New()
 	// Run makefile every min
-	c.AddFunc("* * * * * *", makeFile)
-	c.Start()
-	// Waiting for interrupt by system signal
-	killSignal := <-interrupt
-	stdlog.Println("Got signal:", killSignal)
-	return "Service exited", nil
+	job.cron.AddFunc("* * * * * *", makeFile)
+	job.cron.Start()
+}
+
+// Stop the cron jobs, the daemon calls it on SIGTERM or SIGINT
+func (job *Job) Stop() {
+	stdlog.Println("Stopping cron jobs")
+	job.cron.Stop()
+}
+
+// Run the cron jobs forever, the daemon calls it in an interactive session
+// on Windows only
+func (job *Job) Run() {
+	job.Start()
+	select {}
 }
 
 func init() {
@@ -85,11 +65,6 @@ func main() {
 		errlog.Println("Error: ", err)
 		os.Exit(1)
 	}
-	service := &Service{srv}
-	status, err := service.Manage()
-	if err != nil {
-		errlog.Println(status, "\nError: ", err)
-		os.Exit(1)
-	}
-	fmt.Println(status)
+	// Manage by daemon commands or run the cron jobs until a termination signal
+	os.Exit(daemon.Manage(srv, &Job{}, os.Args[1:]))
 }
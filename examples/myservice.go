@@ -2,12 +2,9 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"net"
 	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/takama/daemon"
 )
@@ -27,83 +24,55 @@ var dependencies = []string{"dummy.service"}
 
 var stdlog, errlog *log.Logger
 
-// Service has embedded daemon
+// Service is the echo service executed by the daemon
 type Service struct {
-	daemon.Daemon
+	listener net.Listener
+	done     chan struct{}
 }
 
-// Manage by daemon commands or run the daemon
-func (service *Service) Manage() (string, error) {
-
-	usage := "Usage: myservice install | remove | start | stop | status"
-
-	// if received any kind of command, do it
-	if len(os.Args) > 1 {
-		command := os.Args[1]
-		switch command {
-		case "install":
-			return service.Install()
-		case "remove":
-			return service.Remove()
-		case "start":
-			return service.Start()
-		case "stop":
-			return service.Stop()
-		case "status":
-			return service.Status()
-		default:
-			return usage, nil
-		}
-	}
-
-	// Do something, call your goroutines, etc
-
-	// Set up channel on which to send signal notifications.
-	// We must use a buffered channel or risk missing the signal
-	// if we're not ready to receive when the signal is sent.
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, os.Kill, syscall.SIGTERM)
-
-	// Set up listener for defined host and port
-	listener, err := net.Listen("tcp", port)
+// Start listening and serving clients
+func (service *Service) Start() {
+	// Set up listener for defined host and port, or take the socket
+	// passed by systemd socket activation
+	listener, err := daemon.Listen(name, port)
 	if err != nil {
-		return "Possibly was a problem with the port binding", err
+		errlog.Println("Possibly was a problem with the port binding", err)
+		os.Exit(1)
 	}
+	service.listener = listener
+	service.done = make(chan struct{})
 
-	// set up channel on which to send accepted connections
-	listen := make(chan net.Conn, 100)
-	go acceptConnection(listener, listen)
+	go acceptConnection(listener, service.done)
+}
 
-	// loop work cycle with accept connections or interrupt
-	// by system signal
-	for {
-		select {
-		case conn := <-listen:
-			go handleClient(conn)
-		case killSignal := <-interrupt:
-			stdlog.Println("Got signal:", killSignal)
-			stdlog.Println("Stoping listening on ", listener.Addr())
-			listener.Close()
-			if killSignal == os.Interrupt {
-				return "Daemon was interrupted by system signal", nil
-			}
-			return "Daemon was killed", nil
-		}
-	}
+// Stop listening, the daemon calls it on SIGTERM or SIGINT
+func (service *Service) Stop() {
+	stdlog.Println("Stoping listening on ", service.listener.Addr())
+	service.listener.Close()
+	<-service.done
+}
+
+// Run serving clients until the listener is closed, the daemon calls it in
+// an interactive session on Windows only
+func (service *Service) Run() {
+	service.Start()
+	<-service.done
 }
 
-// Accept a client connection and collect it in a channel
-func acceptConnection(listener net.Listener, listen chan<- net.Conn) {
+// Accept client connections and serve them until the listener is closed
+func acceptConnection(listener net.Listener, done chan<- struct{}) {
+	defer close(done)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			continue
+			return
 		}
-		listen <- conn
+		go handleClient(conn)
 	}
 }
 
 func handleClient(client net.Conn) {
+	defer client.Close()
 	for {
 		buf := make([]byte, 4096)
 		numbytes, err := client.Read(buf)
@@ -125,12 +94,6 @@ func main() {
 		errlog.Println("Error: ", err)
 		os.Exit(1)
 	}
-	service := &Service{srv}
-	status, err := service.Manage()
-	if err != nil {
-		errlog.Println(status, "\nError: ", err)
-		os.Exit(1)
-	}
-	fmt.Println(status)
-
+	// Manage by daemon commands or run the daemon
+	os.Exit(daemon.Manage(srv, &Service{}, os.Args[1:]))
 }
@@ -0,0 +1,48 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "strings"
+
+// FakeHost - host system of the tests, the process has the credentials
+// and only the listed files and commands exist
+type FakeHost struct {
+	UID       int
+	Caps      uint64
+	KnownCaps bool
+	Files     []string
+}
+
+func (h *FakeHost) credentials() (int, uint64, bool) {
+	return h.UID, h.Caps, h.KnownCaps
+}
+
+func (h *FakeHost) exists(name string) bool {
+	for _, file := range h.Files {
+		if file == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WithHost - use the fake host system instead of the running process
+func WithHost(host *FakeHost) Option {
+	return func(c *config) {
+		c.host = host
+	}
+}
+
+// ApplyFailing - apply the plan with the failing command appended by the
+// config of the options, so the rollback of the applied steps is tested
+func ApplyFailing(plan Plan, command string, options ...Option) error {
+	var cfg config
+	for _, option := range options {
+		option(&cfg)
+	}
+	fields := strings.Fields(command)
+	plan.add(commandStep(fields[0], fields[1:]...))
+	return plan.apply(&cfg)
+}
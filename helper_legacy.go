@@ -10,14 +10,12 @@ import (
 	"errors"
 	"os"
 	"os/exec"
-	"strconv"
-	"strings"
 )
 
 // Service constants
 const (
-	success = "\t\t\t\t\t[  \033[32mOK\033[0m  ]" // Show colored "OK"
-	failed  = "\t\t\t\t\t[\033[31mFAILED\033[0m]" // Show colored "FAILED"
+	success = "\t\t\t\t\t[  OK  ]" // Show "OK", colored by Colorize
+	failed  = "\t\t\t\t\t[FAILED]" // Show "FAILED", colored by Colorize
 )
 
 var (
@@ -38,6 +36,12 @@ var (
 
 	// ErrAlreadyStopped appears if try to stop already stopped service
 	ErrAlreadyStopped = errors.New("Service has already been stopped")
+
+	// ErrStopTimeout appears if the service has not stopped within the stop timeout
+	ErrStopTimeout = errors.New("Service has not stopped within the timeout")
+
+	// ErrUnsupported appears if the operation is not supported by the service manager
+	ErrUnsupported = errors.New("Operation is not supported by the service manager")
 )
 
 // ExecPath tries to get executable path
@@ -54,17 +58,3 @@ func executablePath(name string) (string, error) {
 	}
 	return execPath()
 }
-
-// Check root rights to use system service
-func checkPrivileges() (bool, error) {
-
-	if output, err := exec.Command("id", "-g").Output(); err == nil {
-		if gid, parseErr := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 32); parseErr == nil {
-			if gid == 0 {
-				return true, nil
-			}
-			return false, ErrRootPrivileges
-		}
-	}
-	return false, ErrUnsupportedSystem
-}
@@ -0,0 +1,144 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build go1.21
+
+// Package slogfields provides the slog.Handler of the log sinks which keep
+// the attributes of the records as the named fields, e.g. the journal and
+// the syslog structured data.
+package slogfields
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Format - names of the fields of the sink
+type Format struct {
+	// Separator - the attributes of the groups are named by the group
+	// names and the key joined by the separator
+	Separator string
+
+	// Name - the valid field name of the joined name
+	Name func(name string) string
+
+	// File, Line and Func - names of the fields of the source code
+	// position, if it is added to the records
+	File, Line, Func string
+}
+
+// SendFunc - send the message of the record with the level and the fields
+// to the sink
+type SendFunc func(level slog.Level, message string, fields map[string]string) error
+
+// Handler is the slog.Handler which sends the records with the attributes
+// as the fields
+type Handler struct {
+	send   SendFunc
+	format Format
+	opts   slog.HandlerOptions
+	groups []string
+	fields map[string]string
+}
+
+// New creates the handler sending the records by the function, the default
+// options log the records of the info level and above
+func New(send SendFunc, format Format, opts *slog.HandlerOptions) *Handler {
+	h := &Handler{send: send, format: format, fields: make(map[string]string)}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+// Enabled - is the record of the level logged
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle - send the record
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make(map[string]string, len(h.fields)+r.NumAttrs())
+	for name, value := range h.fields {
+		fields[name] = value
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(fields, h.groups, a)
+		return true
+	})
+
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		fields[h.format.File] = frame.File
+		fields[h.format.Line] = strconv.Itoa(frame.Line)
+		fields[h.format.Func] = frame.Function
+	}
+
+	return h.send(r.Level, r.Message, fields)
+}
+
+// WithAttrs - the handler which adds the attributes to the records
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := h.clone()
+	for _, a := range attrs {
+		handler.appendAttr(handler.fields, handler.groups, a)
+	}
+	return handler
+}
+
+// WithGroup - the handler which puts the attributes of the records in
+// the group
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handler := h.clone()
+	handler.groups = append(handler.groups, name)
+	return handler
+}
+
+// Copy the handler
+func (h *Handler) clone() *Handler {
+	handler := *h
+	handler.groups = append([]string(nil), h.groups...)
+	handler.fields = make(map[string]string, len(h.fields))
+	for name, value := range h.fields {
+		handler.fields[name] = value
+	}
+	return &handler
+}
+
+// Add the attribute to the fields, the groups are expanded
+func (h *Handler) appendAttr(fields map[string]string, groups []string, a slog.Attr) {
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = h.opts.ReplaceAttr(groups, a)
+	}
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(groups[:len(groups):len(groups)], a.Key)
+		}
+		for _, attr := range a.Value.Group() {
+			h.appendAttr(fields, groups, attr)
+		}
+		return
+	}
+
+	name := strings.Join(append(groups[:len(groups):len(groups)], a.Key), h.format.Separator)
+	if h.format.Name != nil {
+		name = h.format.Name(name)
+	}
+	fields[name] = a.Value.String()
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build go1.21
+
+package slogfields
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// record - the sent record
+type record struct {
+	level   slog.Level
+	message string
+	fields  map[string]string
+}
+
+func TestHandler(t *testing.T) {
+	var records []record
+	send := func(level slog.Level, message string, fields map[string]string) error {
+		records = append(records, record{level, message, fields})
+		return nil
+	}
+	format := Format{Separator: "_", Name: strings.ToUpper, File: "CODE_FILE", Line: "CODE_LINE", Func: "CODE_FUNC"}
+
+	logger := slog.New(New(send, format, &slog.HandlerOptions{AddSource: true}))
+	logger.Debug("hidden")
+	logger.With("service", "test").WithGroup("http").Warn("request",
+		"status", 200, slog.Group("client", "ip", "127.0.0.1"), slog.Group("", "inline", true))
+
+	if len(records) != 1 {
+		t.Fatalf("records = %+v; want one record", records)
+	}
+	r := records[0]
+	if r.level != slog.LevelWarn || r.message != "request" {
+		t.Errorf("record = %v %q", r.level, r.message)
+	}
+
+	if r.fields["CODE_FILE"] == "" || r.fields["CODE_LINE"] == "" ||
+		!strings.HasSuffix(r.fields["CODE_FUNC"], "TestHandler") {
+		t.Errorf("source fields = %+v", r.fields)
+	}
+	delete(r.fields, "CODE_FILE")
+	delete(r.fields, "CODE_LINE")
+	delete(r.fields, "CODE_FUNC")
+
+	want := map[string]string{
+		"SERVICE":        "test",
+		"HTTP_STATUS":    "200",
+		"HTTP_CLIENT_IP": "127.0.0.1",
+		"HTTP_INLINE":    "true",
+	}
+	if !reflect.DeepEqual(r.fields, want) {
+		t.Errorf("fields = %+v; want %+v", r.fields, want)
+	}
+}
+
+func TestHandlerReplaceAttr(t *testing.T) {
+	var fields map[string]string
+	send := func(level slog.Level, message string, f map[string]string) error {
+		fields = f
+		return nil
+	}
+	opts := &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "secret" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+
+	logger := slog.New(New(send, Format{Separator: "."}, opts))
+	logger.WithGroup("db").Debug("query", "secret", "password", "table", "users")
+
+	if want := map[string]string{"db.table": "users"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %+v; want %+v", fields, want)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package journal provides logging of the services to the systemd journal by
+// its native protocol: the entries keep the priority, the identifier of the
+// service and the custom fields, see systemd.journal-fields(7).
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Priority of the journal entry, the syslog levels
+type Priority int
+
+// Priorities of the journal entries
+const (
+	PriEmerg Priority = iota
+	PriAlert
+	PriCrit
+	PriErr
+	PriWarning
+	PriNotice
+	PriInfo
+	PriDebug
+)
+
+// Socket of journald for the native protocol, replaced in tests
+var socketPath = "/run/systemd/journal/socket"
+
+// Maximum length of the field name
+const maxFieldName = 64
+
+// Journal is the logger which sends the entries to the journal. It is safe
+// for concurrent use.
+type Journal struct {
+	identifier string
+	fields     map[string]string
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// Enabled - is the journal available on the system
+func Enabled() bool {
+	_, err := os.Stat(socketPath)
+	return err == nil
+}
+
+// New creates the logger of the service, the entries are identified by
+// SYSLOG_IDENTIFIER and have the fields in addition to their own ones
+func New(identifier string, fields map[string]string) (*Journal, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{identifier: identifier, fields: fields, conn: conn}, nil
+}
+
+// Send the message to the journal with the priority and the fields, the
+// names of the fields are converted to the journal ones: "request id"
+// becomes REQUEST_ID
+func (j *Journal) Send(priority Priority, message string, fields map[string]string) error {
+	var data bytes.Buffer
+	appendField(&data, "MESSAGE", message)
+	appendField(&data, "PRIORITY", string(rune('0'+priority)))
+	if j.identifier != "" {
+		appendField(&data, "SYSLOG_IDENTIFIER", j.identifier)
+	}
+	for name, value := range j.fields {
+		appendField(&data, fieldName(name), value)
+	}
+	for name, value := range fields {
+		appendField(&data, fieldName(name), value)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	_, err := j.conn.Write(data.Bytes())
+	if err != nil && isTooLarge(err) {
+		// the large entries are passed in the memory file
+		err = sendFile(j.conn, data.Bytes())
+	}
+
+	return err
+}
+
+// Write the entry with the info priority, so the journal can be the output
+// of the standard logger
+func (j *Journal) Write(p []byte) (int, error) {
+	if err := j.Send(PriInfo, strings.TrimRight(string(p), "\n"), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close the connection to the journal
+func (j *Journal) Close() error {
+	return j.conn.Close()
+}
+
+// Append the field in the native protocol format, the values with newlines
+// are preceded by their length
+func appendField(data *bytes.Buffer, name, value string) {
+	if name == "" {
+		return
+	}
+
+	data.WriteString(name)
+	if !strings.ContainsRune(value, '\n') {
+		data.WriteByte('=')
+		data.WriteString(value)
+		data.WriteByte('\n')
+		return
+	}
+
+	data.WriteByte('\n')
+	binary.Write(data, binary.LittleEndian, uint64(len(value)))
+	data.WriteString(value)
+	data.WriteByte('\n')
+}
+
+// Get the journal field name: upper case letters, digits and underscores,
+// not starting with an underscore (trusted fields) or a digit
+func fieldName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9' && b.Len() > 0:
+			b.WriteRune(r)
+		case b.Len() > 0:
+			b.WriteByte('_')
+		}
+		if b.Len() == maxFieldName {
+			break
+		}
+	}
+	return strings.TrimRight(b.String(), "_")
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// StderrIsJournal - is the standard error connected to the journal, systemd
+// sets JOURNAL_STREAM to the device and inode of the stream it reads
+func StderrIsJournal() bool {
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(os.Getenv("JOURNAL_STREAM"), "%d:%d", &dev, &ino); err != nil {
+		return false
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(int(os.Stderr.Fd()), &stat); err != nil {
+		return false
+	}
+
+	return uint64(stat.Dev) == dev && uint64(stat.Ino) == ino
+}
+
+// Is the entry too large for the datagram
+func isTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// Send the entry in the sealed memory file, or in the unlinked file in
+// /dev/shm if memfd is not supported, journald reads the entry from the
+// passed descriptor
+func sendFile(conn *net.UnixConn, data []byte) error {
+	file, sealed, err := entryFile()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	if sealed {
+		if _, err := unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS,
+			unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+			return err
+		}
+	}
+
+	// the descriptor is sent by the connected socket itself, WriteMsgUnix
+	// does not allow it
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	if err := raw.Write(func(fd uintptr) bool {
+		err = unix.Sendmsg(int(fd), nil, unix.UnixRights(int(file.Fd())), nil, 0)
+		return err != unix.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return err
+}
+
+// Create the file for the entry, true if it can be sealed
+func entryFile() (*os.File, bool, error) {
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err == nil {
+		return os.NewFile(uintptr(fd), "journal-entry"), true, nil
+	}
+
+	file, err := ioutil.TempFile("/dev/shm", "journal.")
+	if err != nil {
+		return nil, false, err
+	}
+	os.Remove(file.Name())
+
+	return file, false, nil
+}
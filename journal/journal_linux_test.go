@@ -0,0 +1,123 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package journal
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Bind the journal socket and connect the logger to it
+func listenJournal(t *testing.T) (*net.UnixConn, *Journal) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	saved := socketPath
+	socketPath = path
+	t.Cleanup(func() { socketPath = saved })
+
+	j, err := New("test", map[string]string{"unit": "test.service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+
+	return conn, j
+}
+
+// Read the next entry, from the datagram or from the passed file
+func readEntry(t *testing.T, conn *net.UnixConn) (string, *os.File) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatalf("no entry: %v", err)
+	}
+	if oobn == 0 {
+		return string(buf[:n]), nil
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("control messages = %v, %v", msgs, err)
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("passed descriptors = %v, %v", fds, err)
+	}
+	file := os.NewFile(uintptr(fds[0]), "entry")
+	t.Cleanup(func() { file.Close() })
+
+	// the descriptor shares the offset of the written file, journald
+	// reads it from the start
+	data, err := ioutil.ReadAll(io.NewSectionReader(file, 0, 1<<30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), file
+}
+
+func TestSend(t *testing.T) {
+	conn, j := listenJournal(t)
+
+	if err := j.Send(PriWarning, "disk is full", map[string]string{"request id": "42"}); err != nil {
+		t.Fatal(err)
+	}
+	entry, file := readEntry(t, conn)
+	if file != nil {
+		t.Fatal("small entry is passed in the file")
+	}
+	for _, field := range []string{
+		"MESSAGE=disk is full\n",
+		"PRIORITY=4\n",
+		"SYSLOG_IDENTIFIER=test\n",
+		"UNIT=test.service\n",
+		"REQUEST_ID=42\n",
+	} {
+		if !strings.Contains(entry, field) {
+			t.Errorf("entry %q has no %q", entry, field)
+		}
+	}
+}
+
+func TestSendTooLarge(t *testing.T) {
+	conn, j := listenJournal(t)
+
+	// larger than the send buffer of the socket
+	message := strings.Repeat("x", 4<<20)
+	if err := j.Send(PriInfo, message, nil); err != nil {
+		t.Fatal(err)
+	}
+	entry, file := readEntry(t, conn)
+	if file == nil {
+		t.Fatal("large entry is not passed in the file")
+	}
+	if !strings.HasPrefix(entry, "MESSAGE="+message+"\n") {
+		t.Errorf("entry of %d bytes has no message", len(entry))
+	}
+
+	// journald refuses the memory files which are not sealed
+	seals, err := unix.FcntlInt(file.Fd(), unix.F_GET_SEALS, 0)
+	if err != nil {
+		t.Skipf("memfd is not supported: %v", err)
+	}
+	want := unix.F_SEAL_SHRINK | unix.F_SEAL_GROW | unix.F_SEAL_WRITE | unix.F_SEAL_SEAL
+	if seals&want != want {
+		t.Errorf("seals = %#x; want %#x", seals, want)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !linux
+
+package journal
+
+import (
+	"errors"
+	"net"
+)
+
+// StderrIsJournal - is the standard error connected to the journal, never on
+// the systems without systemd
+func StderrIsJournal() bool {
+	return false
+}
+
+// Is the entry too large for the datagram
+func isTooLarge(err error) bool {
+	return false
+}
+
+// Send the entry in the file, the journal is available on linux only
+func sendFile(conn *net.UnixConn, data []byte) error {
+	return errors.New("journal is not supported")
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package journal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAppendField(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value string
+		want  string
+	}{
+		{"single line", "MESSAGE", "started", "MESSAGE=started\n"},
+		{"empty value", "MESSAGE", "", "MESSAGE=\n"},
+		{"empty name", "", "started", ""},
+		{
+			"multi-line", "MESSAGE", "first\nsecond",
+			"MESSAGE\n\x0c\x00\x00\x00\x00\x00\x00\x00first\nsecond\n",
+		},
+		{
+			"trailing newline", "TRACE", "line\n",
+			"TRACE\n\x05\x00\x00\x00\x00\x00\x00\x00line\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data bytes.Buffer
+			appendField(&data, test.field, test.value)
+			if data.String() != test.want {
+				t.Errorf("appendField(%q, %q) = %q; want %q", test.field, test.value, data.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"request_id", "REQUEST_ID"},
+		{"request id", "REQUEST_ID"},
+		{"Request-ID", "REQUEST_ID"},
+		{"user.name", "USER_NAME"},
+		{"_trusted", "TRUSTED"},
+		{"__CURSOR", "CURSOR"},
+		{"1st try", "ST_TRY"},
+		{"code2", "CODE2"},
+		{"trailing!", "TRAILING"},
+		{"päth", "P_TH"},
+		{"!@#", ""},
+		{strings.Repeat("a", 70), strings.Repeat("A", maxFieldName)},
+		{strings.Repeat("a", 63) + " b", strings.Repeat("A", 63)},
+	}
+
+	for _, test := range tests {
+		if got := fieldName(test.name); got != test.want {
+			t.Errorf("fieldName(%q) = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
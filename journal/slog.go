@@ -0,0 +1,48 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build go1.21
+
+package journal
+
+import (
+	"log/slog"
+
+	"github.com/takama/daemon/internal/slogfields"
+)
+
+// Handler is the slog.Handler which sends the records to the journal, the
+// attributes become the fields of the entries, the attributes of the groups
+// are prefixed by the group names: GROUP_KEY
+type Handler = slogfields.Handler
+
+// Fields of the journal entries
+var handlerFormat = slogfields.Format{
+	Separator: "_",
+	Name:      fieldName,
+	File:      "CODE_FILE",
+	Line:      "CODE_LINE",
+	Func:      "CODE_FUNC",
+}
+
+// NewHandler creates the handler of the journal, the default options log the
+// records of the info level and above
+func NewHandler(j *Journal, opts *slog.HandlerOptions) *Handler {
+	return slogfields.New(func(level slog.Level, message string, fields map[string]string) error {
+		return j.Send(priority(level), message, fields)
+	}, handlerFormat, opts)
+}
+
+// Get the journal priority of the level
+func priority(level slog.Level) Priority {
+	switch {
+	case level >= slog.LevelError:
+		return PriErr
+	case level >= slog.LevelWarn:
+		return PriWarning
+	case level >= slog.LevelInfo:
+		return PriInfo
+	}
+	return PriDebug
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/takama/daemon/journal"
+	"github.com/takama/daemon/logfile"
+	"github.com/takama/daemon/syslog"
+)
+
+// Time given to the executable to stop if it is not set by WithStopTimeout
+const defaultStopTimeout = 10 * time.Second
+
+// Reloader is implemented by the executable which is able to reload its
+// configuration, Run calls Reload when the service receives SIGHUP
+type Reloader interface {
+	// Reload - reload configuration of the service
+	Reload()
+}
+
+// ReloaderContext is implemented by the context-aware executable which is
+// able to reload its configuration, RunContext calls Reload when the service
+// receives SIGHUP
+type ReloaderContext interface {
+	// Reload - reload configuration of the service
+	Reload(ctx context.Context) error
+}
+
+// Finisher is implemented by the executable whose work may finish by itself,
+// e.g. the batch job: Run and RunContext stop the executable and return when
+// the channel is closed, as if the service received SIGTERM
+type Finisher interface {
+	// Done - the channel is closed when the work of the service is finished,
+	// it is called after Start
+	Done() <-chan struct{}
+}
+
+// executableAdapter - runs Executable as ExecutableContext
+type executableAdapter struct {
+	executable Executable
+}
+
+func (adapter *executableAdapter) Start(ctx context.Context) error {
+	adapter.executable.Start()
+	return nil
+}
+
+func (adapter *executableAdapter) Stop(ctx context.Context) error {
+	adapter.executable.Stop()
+	return nil
+}
+
+func (adapter *executableAdapter) Reload(ctx context.Context) error {
+	if reloader, ok := adapter.executable.(Reloader); ok {
+		reloader.Reload()
+	}
+	return nil
+}
+
+func (adapter *executableAdapter) Done() <-chan struct{} {
+	if finisher, ok := adapter.executable.(Finisher); ok {
+		return finisher.Done()
+	}
+	return nil
+}
+
+// Send the log of the service to the sink selected by WithSyslog or
+// WithLogFile, or to the journal if the output of the service goes there,
+// so the log entries keep their priority and fields
+func (c *config) startLog(name string) error {
+	switch {
+	case c.syslog:
+		facility := c.facility
+		if facility == 0 {
+			facility = syslog.FacilityDaemon
+		}
+		w, err := syslog.New(name, facility)
+		if err != nil {
+			return err
+		}
+		useSyslog(w)
+	case c.logFile != "":
+		f, err := logfile.Open(c.logFile, c.logRotation)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(f)
+	case journal.StderrIsJournal():
+		if j, err := journal.New(name, nil); err == nil {
+			useJournal(j)
+		}
+	}
+	return nil
+}
+
+// Run the executable of the service by Run of the service managers other
+// than windows: the log of the service is started and the pid file is locked
+// while the executable is running, so the second instance does not run
+func (c *config) run(name, description string, kind Kind, e ExecutableContext) error {
+	if err := c.startLog(name); err != nil {
+		return err
+	}
+
+	release, err := c.runPidFile(name, kind)
+	if err != nil {
+		return err
+	}
+
+	err = runExecutable(description, e, c.stopTimeout)
+	if releaseErr := release(); err == nil && releaseErr != nil {
+		return fmt.Errorf("Pid file of the stopped service is not removed: %w", releaseErr)
+	}
+	return err
+}
+
+// Run the executable with the same lifecycle as the windows service manager
+// provides: start it, wait for SIGTERM or SIGINT and stop it within the stop
+// timeout. The context passed to Start is cancelled by the termination
+// signal. SIGHUP reloads the executable if it implements ReloaderContext. The
+// executable which implements Finisher is also stopped when its work is
+// finished.
+func runExecutable(description string, e ExecutableContext, stopTimeout time.Duration) error {
+	if stopTimeout <= 0 {
+		stopTimeout = defaultStopTimeout
+	}
+
+	// Set up channel on which to send signal notifications.
+	// We must use a buffered channel or risk missing the signal
+	// if we're not ready to receive when the signal is sent.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the start may take a while, so signals are handled meanwhile
+	started := make(chan error, 1)
+	go func() {
+		started <- e.Start(ctx)
+	}()
+
+	running := false
+	var finished <-chan struct{}
+	watchdog := make(chan<- struct{})
+	defer func() {
+		if running {
+			close(watchdog)
+		}
+	}()
+
+wait:
+	for {
+		select {
+		case err := <-started:
+			if err != nil {
+				Notify("STATUS=Failed to start " + description + ": " + err.Error())
+				return err
+			}
+			running = true
+			Notify(NotifyReady + "\nSTATUS=Running " + description)
+			watchdog = startWatchdog()
+			if finisher, ok := e.(Finisher); ok {
+				finished = finisher.Done()
+			}
+		case <-finished:
+			break wait
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			if reloader, ok := e.(ReloaderContext); ok && running {
+				Notify(NotifyReloading)
+				if err := reloader.Reload(ctx); err != nil {
+					Notify(NotifyReady + "\nSTATUS=Failed to reload " + description + ": " + err.Error())
+				} else {
+					Notify(NotifyReady + "\nSTATUS=Running " + description)
+				}
+			}
+		}
+	}
+
+	cancel()
+	Notify(NotifyStopping)
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer stopCancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		// the cancelled start has to finish before the stop
+		if !running {
+			if err := <-started; err != nil {
+				if err == context.Canceled {
+					err = nil
+				}
+				stopped <- err
+				return
+			}
+		}
+		stopped <- e.Stop(stopCtx)
+	}()
+
+	// the repeated termination signal does not wait for the stop anymore
+	for {
+		select {
+		case err := <-stopped:
+			return err
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				return ErrStopTimeout
+			}
+		case <-stopCtx.Done():
+			return ErrStopTimeout
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+// Batch job whose work finishes by itself
+type batchJob struct {
+	calls []string
+	done  chan struct{}
+}
+
+func (job *batchJob) Start() {
+	job.calls = append(job.calls, "Start")
+	job.done = make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(job.done)
+	}()
+}
+
+func (job *batchJob) Stop() {
+	job.calls = append(job.calls, "Stop")
+}
+
+func (job *batchJob) Run() {
+	job.calls = append(job.calls, "Run")
+}
+
+func (job *batchJob) Done() <-chan struct{} {
+	return job.done
+}
+
+func TestRunExecutableFinished(t *testing.T) {
+	job := &batchJob{}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runExecutable("Test service", &executableAdapter{job}, time.Second)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runExecutable() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runExecutable() does not return when the work is finished")
+	}
+
+	if got := len(job.calls); got != 2 || job.calls[0] != "Start" || job.calls[1] != "Stop" {
+		t.Errorf("calls = %q; want Start and Stop", job.calls)
+	}
+}
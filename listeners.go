@@ -0,0 +1,110 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// The first file descriptor passed by socket activation
+const listenFdsStart = 3
+
+// Sockets passed to the process by socket activation
+var activation struct {
+	sync.Mutex
+	once      sync.Once
+	listeners []net.Listener
+	names     []string
+	err       error
+}
+
+// Listeners returns listeners for all sockets passed to the service by
+// systemd socket activation (LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES
+// environment variables), nil if the service was not socket activated.
+// The listeners which are already taken by Listen are not returned.
+func Listeners() ([]net.Listener, error) {
+	activation.once.Do(inheritListeners)
+	activation.Lock()
+	defer activation.Unlock()
+
+	var listeners []net.Listener
+	for _, listener := range activation.listeners {
+		if listener != nil {
+			listeners = append(listeners, listener)
+		}
+	}
+
+	return listeners, activation.err
+}
+
+// Listen returns a listener for the socket of the address passed to the
+// service with given name by socket activation, the sockets installed by
+// WithSocket are named after the service and the address. The socket named
+// only after the service is taken if there is no such socket. If there is no
+// socket, it listens on the address, which is a TCP address or a path of a
+// unix socket.
+func Listen(name, fallbackAddr string) (net.Listener, error) {
+	activation.once.Do(inheritListeners)
+	activation.Lock()
+	for _, socket := range []string{socketName(name, fallbackAddr), name} {
+		for i, listener := range activation.listeners {
+			if listener != nil && activation.names[i] == socket {
+				activation.listeners[i] = nil
+				activation.Unlock()
+				return listener, nil
+			}
+		}
+	}
+	activation.Unlock()
+
+	if strings.HasPrefix(fallbackAddr, "/") || strings.HasPrefix(fallbackAddr, "@") {
+		return net.Listen("unix", fallbackAddr)
+	}
+	return net.Listen("tcp", fallbackAddr)
+}
+
+// Collect the sockets passed by socket activation, the environment variables
+// are unset so child processes do not inherit them
+func inheritListeners() {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < count; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			activation.err = err
+			continue
+		}
+		activation.listeners = append(activation.listeners, listener)
+		activation.names = append(activation.names, name)
+	}
+}
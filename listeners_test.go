@@ -0,0 +1,86 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSocketName(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":9977", "myservice-9977"},
+		{"127.0.0.1:80", "myservice-127.0.0.1_80"},
+		{"[::1]:80", "myservice-[__1]_80"},
+		{"/run/myservice.sock", "myservice-/run/myservice.sock"},
+		{"/run/сервис.sock", "myservice-/run/______.sock"},
+	}
+	for _, test := range tests {
+		if name := socketName("myservice", test.addr); name != test.want {
+			t.Errorf("socketName(%q) = %q; want %q", test.addr, name, test.want)
+		}
+	}
+}
+
+func TestListenActivated(t *testing.T) {
+	listen := func() net.Listener {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		return listener
+	}
+
+	first, second, legacy := listen(), listen(), listen()
+
+	// the sockets passed by socket activation
+	activation.once.Do(func() {})
+	activation.Lock()
+	activation.listeners = []net.Listener{first, second, legacy}
+	activation.names = []string{"myservice-8080", "myservice-127.0.0.1_9090", "other"}
+	activation.Unlock()
+	t.Cleanup(func() {
+		activation.Lock()
+		activation.listeners, activation.names = nil, nil
+		activation.Unlock()
+	})
+
+	tests := []struct {
+		name, addr string
+		want       net.Listener
+	}{
+		{"myservice", "127.0.0.1:9090", second},
+		{"myservice", ":8080", first},
+		{"other", ":7070", legacy},
+	}
+	for _, test := range tests {
+		listener, err := Listen(test.name, test.addr)
+		if err != nil {
+			t.Fatalf("Listen(%q, %q) error = %v", test.name, test.addr, err)
+		}
+		if listener != test.want {
+			t.Errorf("Listen(%q, %q) = %v; want %v", test.name, test.addr, listener.Addr(), test.want.Addr())
+		}
+	}
+
+	// the taken sockets are not returned again, Listen listens on the address
+	listener, err := Listen("myservice", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if listener == first || listener == second {
+		t.Errorf("Listen() returned the taken socket %v", listener.Addr())
+	}
+	if listeners, _ := Listeners(); len(listeners) != 0 {
+		t.Errorf("Listeners() = %d listeners; want none", len(listeners))
+	}
+}
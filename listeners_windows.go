@@ -0,0 +1,21 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"net"
+)
+
+// Listeners returns listeners for all sockets passed to the service by
+// socket activation, there is no socket activation on windows
+func Listeners() ([]net.Listener, error) {
+	return nil, nil
+}
+
+// Listen listens on the fallback address, there is no socket activation on
+// windows
+func Listen(name, fallbackAddr string) (net.Listener, error) {
+	return net.Listen("tcp", fallbackAddr)
+}
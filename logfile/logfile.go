@@ -0,0 +1,291 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package logfile provides the log file of the service which is rotated by
+// its size or age, the rotated files are compressed and removed after the
+// retention period by the service itself, without logrotate.
+package logfile
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suffix of the rotated files, the time of the rotation, followed by the
+// counter of the files rotated in the same millisecond: .1, .2 and so on
+const timeFormat = "20060102T150405.000"
+
+// Options of the rotation of the log file
+type Options struct {
+	// MaxSize - the file is rotated when its size exceeds the limit in
+	// bytes, no limit if zero
+	MaxSize int64
+
+	// Interval - the file is rotated when it is older than the interval,
+	// e.g. 24 hours for the daily files, no limit if zero
+	Interval time.Duration
+
+	// MaxBackups - number of the kept rotated files, all files if zero
+	MaxBackups int
+
+	// MaxAge - the rotated files older than the age are removed, the files
+	// are kept forever if zero
+	MaxAge time.Duration
+
+	// Compress - compress the rotated files by gzip
+	Compress bool
+
+	// Mode - permissions of the created file, 0644 if zero
+	Mode os.FileMode
+}
+
+// File is the log file which is rotated by the writes. It is safe for
+// concurrent use.
+type File struct {
+	path string
+	opts Options
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+
+	// the rotated files are compressed and removed in the background
+	cleanup   sync.WaitGroup
+	cleanupMu sync.Mutex
+}
+
+// Open the log file for appending, the file is created if it does not
+// exist
+func Open(path string, opts Options) (*File, error) {
+	if opts.Mode == 0 {
+		opts.Mode = 0644
+	}
+
+	f := &File{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Open the current file, the age of the existing file is counted from its
+// last modification
+func (f *File) open() error {
+	file, err := openFile(f.path, f.opts.Mode)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size, f.created = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		f.created = info.ModTime()
+	}
+
+	return nil
+}
+
+// Write the data to the file, the file is rotated before the write if it
+// exceeds the limits
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size > 0 && (f.opts.MaxSize > 0 && f.size+int64(len(p)) > f.opts.MaxSize ||
+		f.opts.Interval > 0 && time.Since(f.created) >= f.opts.Interval) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate the file now
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Rename the current file to the rotated one and open the new file, the
+// current file is kept open until the new file is opened, so the writes
+// are not lost if the rotation fails
+func (f *File) rotate() error {
+	rotated := rotatedName(f.path + "." + time.Now().Format(timeFormat))
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+
+	current := f.file
+	if err := f.open(); err != nil {
+		return err
+	}
+	if err := current.Close(); err != nil {
+		return err
+	}
+
+	// the rotated files are compressed and removed one rotation at a time
+	f.cleanup.Add(1)
+	go func() {
+		defer f.cleanup.Done()
+		f.cleanupMu.Lock()
+		defer f.cleanupMu.Unlock()
+
+		if f.opts.Compress {
+			compress(rotated)
+		}
+		f.removeExpired()
+	}()
+
+	return nil
+}
+
+// Get the name of the rotated file which is not used by the former
+// rotation, compressed or not
+func rotatedName(name string) string {
+	rotated := name
+	for i := 1; exists(rotated) || exists(rotated+".gz"); i++ {
+		rotated = name + "." + strconv.Itoa(i)
+	}
+	return rotated
+}
+
+// Does the file exist
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+// Close the file, it waits for the compression of the rotated files
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	f.cleanup.Wait()
+
+	return err
+}
+
+// Compress the rotated file to the gzip file next to it
+func compress(path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	target, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		target.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		target.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := target.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// Remove the rotated files over the number of backups or older than the
+// maximum age
+func (f *File) removeExpired() {
+	if f.opts.MaxBackups <= 0 && f.opts.MaxAge <= 0 {
+		return
+	}
+
+	// the rotated files are sorted by the time of the rotation and by the
+	// counter, the newest first
+	paths, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	type rotatedFile struct {
+		path    string
+		time    string
+		counter int
+	}
+	var rotated []rotatedFile
+	for _, path := range paths {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(path, f.path+"."), ".gz")
+		if len(suffix) < len(timeFormat) {
+			continue
+		}
+		if _, err := time.Parse(timeFormat, suffix[:len(timeFormat)]); err != nil {
+			continue
+		}
+		counter := 0
+		if rest := suffix[len(timeFormat):]; rest != "" {
+			if counter, err = strconv.Atoi(strings.TrimPrefix(rest, ".")); err != nil ||
+				rest[0] != '.' || counter <= 0 {
+				continue
+			}
+		}
+		rotated = append(rotated, rotatedFile{path, suffix[:len(timeFormat)], counter})
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		if rotated[i].time != rotated[j].time {
+			return rotated[i].time > rotated[j].time
+		}
+		return rotated[i].counter > rotated[j].counter
+	})
+
+	for i, file := range rotated {
+		if f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups {
+			os.Remove(file.path)
+			continue
+		}
+		if info, err := os.Stat(file.path); err == nil && f.opts.MaxAge > 0 &&
+			time.Since(info.ModTime()) > f.opts.MaxAge {
+			os.Remove(file.path)
+		}
+	}
+}
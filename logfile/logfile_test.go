@@ -0,0 +1,201 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package logfile
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Get the rotated files of the log file
+func rotatedFiles(t *testing.T, path string) []string {
+	paths, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	f, err := Open(path, Options{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "third\n" {
+		t.Errorf("current file = %q; want %q", data, "third\n")
+	}
+
+	var rotated []string
+	for _, name := range rotatedFiles(t, path) {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotated = append(rotated, string(data))
+	}
+	if got := strings.Join(rotated, ""); got != "first\nsecond\n" {
+		t.Errorf("rotated files = %q; want first and second", got)
+	}
+}
+
+func TestRotateFailureKeepsFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "service.log")
+
+	f, err := Open(path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file can not be renamed without its directory
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Rotate(); err == nil {
+		t.Fatal("Rotate() succeeded without the directory")
+	}
+
+	if _, err := f.Write([]byte("kept\n")); err != nil {
+		t.Errorf("Write() after the failed rotation error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close() after the failed rotation error = %v", err)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	f, err := Open(path, Options{MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := f.Write([]byte("line\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := rotatedFiles(t, path)
+	if len(rotated) != 2 {
+		t.Fatalf("rotated files = %q; want 2 backups", rotated)
+	}
+	for _, name := range rotated {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("rotated file %s is not compressed", name)
+			continue
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		data, err := ioutil.ReadAll(reader)
+		file.Close()
+		if err != nil || string(data) != "line\n" {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, "line\n")
+		}
+	}
+}
+
+func TestRotateSameMillisecond(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"all backups", Options{}, []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}},
+		{"newest backups", Options{MaxBackups: 3}, []string{"10", "11", "12"}},
+		{"compressed", Options{MaxBackups: 3, Compress: true}, []string{"10", "11", "12"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "service.log")
+			f, err := Open(path, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the rotations without the pause share the time suffix
+			for i := 1; i <= 12; i++ {
+				if _, err := f.Write([]byte(strconv.Itoa(i))); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.Rotate(); err != nil {
+					t.Fatalf("Rotate() error = %v", err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var backups []string
+			for _, name := range rotatedFiles(t, path) {
+				file, err := os.Open(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var reader io.Reader = file
+				if strings.HasSuffix(name, ".gz") {
+					if reader, err = gzip.NewReader(file); err != nil {
+						t.Fatalf("%s: %v", name, err)
+					}
+				}
+				data, err := ioutil.ReadAll(reader)
+				file.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				backups = append(backups, string(data))
+			}
+			sort.Slice(backups, func(i, j int) bool {
+				a, _ := strconv.Atoi(backups[i])
+				b, _ := strconv.Atoi(backups[j])
+				return a < b
+			})
+			if strings.Join(backups, " ") != strings.Join(test.want, " ") {
+				t.Errorf("backups = %q; want %q", backups, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"text/template"
+)
+
+// Schedules of the rotation known by logrotate
+var logRotationSchedules = map[string]bool{
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+	"yearly":  true,
+}
+
+// logRotationData - values of the logrotate configuration
+type logRotationData struct {
+	Paths    []string
+	Schedule string
+	Size     string
+	Rotate   int
+	Compress bool
+	Signal   string
+	PID      string
+}
+
+// Path of the logrotate configuration of the service in the system
+func logRotationPath(name string) string {
+	return "/etc/logrotate.d/" + name
+}
+
+// Render the logrotate configuration of the log files, the pid command
+// prints the pid of the service to be signaled after the rotation
+func renderLogRotation(rotation *LogRotation, paths []string, pid string) (string, error) {
+	data := &logRotationData{
+		Paths:    paths,
+		Schedule: rotation.Schedule,
+		Size:     rotation.Size,
+		Rotate:   rotation.Rotate,
+		Compress: rotation.Compress,
+		Signal:   strings.TrimPrefix(strings.ToUpper(rotation.Signal), "SIG"),
+		PID:      pid,
+	}
+	if data.Schedule == "" && data.Size == "" {
+		data.Schedule = "daily"
+	}
+	if data.Rotate <= 0 {
+		data.Rotate = 7
+	}
+
+	if data.Schedule != "" && !logRotationSchedules[data.Schedule] {
+		return "", errors.New("Unknown log rotation schedule: " + data.Schedule)
+	}
+	if strings.ContainsAny(data.Size, " \n") {
+		return "", errors.New("Invalid log rotation size: " + data.Size)
+	}
+	for _, r := range data.Signal {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return "", errors.New("Invalid log rotation signal: " + rotation.Signal)
+		}
+	}
+
+	templ, err := template.New("logRotationConfig").Parse(logRotationConfig)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// The size is the only condition without the schedule, the files are
+// rotated by the size or the schedule otherwise
+var logRotationConfig = `{{range .Paths}}{{.}} {{end}}{
+{{- if .Schedule}}
+    {{.Schedule}}
+{{- if .Size}}
+    maxsize {{.Size}}
+{{- end}}
+{{- else}}
+    size {{.Size}}
+{{- end}}
+    rotate {{.Rotate}}
+    missingok
+    notifempty
+{{- if .Compress}}
+    compress
+    delaycompress
+{{- end}}
+{{- if .Signal}}
+    sharedscripts
+    postrotate
+        pid=$({{.PID}}) && [ -n "$pid" ] && kill -{{.Signal}} $pid || true
+    endscript
+{{- else}}
+    copytruncate
+{{- end}}
+}
+`
@@ -0,0 +1,414 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval of the checks of the followed log files
+const logPollInterval = 250 * time.Millisecond
+
+// Size of the blocks read from the end of the log file
+const logBlockSize = 64 * 1024
+
+// LogOptions - selection of the lines of the service log
+type LogOptions struct {
+	// Lines - number of the last lines, all lines if zero, also when the
+	// log is followed: the whole log is replayed before the new lines, set
+	// Lines to follow the tail only. The lines of the log files (the output
+	// and the errors) are merged by their time first.
+	Lines int
+
+	// Since - only the lines logged after the time. The time of the line in
+	// the log file is read from its prefix, RFC 3339 time or the time of the
+	// standard logger ("2006/01/02 15:04:05"), the lines without the time get
+	// the time of the previous line or the modification time of the file.
+	Since time.Time
+
+	// Follow - keep reading the new lines until the reader is closed
+	Follow bool
+}
+
+// Read the service log from the journal, the entries are formatted as
+// "<time> <message>" lines
+func journalLogs(runner CommandRunner, user bool, unit string, opts LogOptions) (io.ReadCloser, error) {
+	args := []string{"-u", unit, "-o", "json"}
+	if user {
+		args = []string{"--user-unit", unit, "-o", "json"}
+	}
+	switch {
+	case opts.Lines > 0:
+		args = append(args, "-n", strconv.Itoa(opts.Lines))
+	case opts.Follow:
+		args = append(args, "-n", "all")
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", "@"+strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+
+	if !opts.Follow {
+		output, err := runner.Run("journalctl", args...)
+		if err != nil {
+			return nil, err
+		}
+		return formatJournal(ioutil.NopCloser(bytes.NewReader(output)), nil), nil
+	}
+
+	// the runner returns the output when the command has finished, so the
+	// followed journal is read from the running command
+	stream, err := streamCommand(runner, "journalctl", append(args, "-f")...)
+	if err != nil {
+		return nil, err
+	}
+
+	return formatJournal(stream, func() { stream.Close() }), nil
+}
+
+// journalEntry - fields of the journal entry in the journalctl JSON output
+type journalEntry struct {
+	Timestamp string      `json:"__REALTIME_TIMESTAMP"`
+	Message   interface{} `json:"MESSAGE"`
+}
+
+// Format the journal entries, the stop function is called when the reader
+// is closed
+func formatJournal(source io.ReadCloser, stop func()) io.ReadCloser {
+	reader, writer := io.Pipe()
+
+	go func() {
+		defer source.Close()
+
+		scanner := bufio.NewScanner(source)
+		scanner.Buffer(make([]byte, logBlockSize), 16*logBlockSize)
+		for scanner.Scan() {
+			var entry journalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+
+			line := journalMessage(entry.Message) + "\n"
+			if usec, err := strconv.ParseInt(entry.Timestamp, 10, 64); err == nil {
+				line = time.Unix(0, usec*int64(time.Microsecond)).Format(time.RFC3339) + " " + line
+			}
+
+			if _, err := io.WriteString(writer, line); err != nil {
+				return
+			}
+		}
+		writer.CloseWithError(scanner.Err())
+	}()
+
+	return &logReader{PipeReader: reader, stop: stop}
+}
+
+// Get the message of the journal entry, the binary messages are given
+// as arrays of bytes
+func journalMessage(message interface{}) string {
+	switch m := message.(type) {
+	case string:
+		return m
+	case []interface{}:
+		data := make([]byte, 0, len(m))
+		for _, b := range m {
+			if n, ok := b.(float64); ok {
+				data = append(data, byte(n))
+			}
+		}
+		return string(bytes.TrimRight(data, "\n"))
+	}
+	return ""
+}
+
+// Read the service log from the log files, the lines of the files are
+// merged by their time and then the files are followed together
+func fileLogs(paths []string, opts LogOptions) (io.ReadCloser, error) {
+	offsets := make([]int64, len(paths))
+	var files [][]logLine
+	var found bool
+	var notFound error
+
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			notFound = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		offsets[i] = info.Size()
+
+		if !opts.Since.IsZero() && info.ModTime().Before(opts.Since) {
+			continue
+		}
+
+		// the last lines of the merged log are among the last lines of
+		// each file, the lines logged after the time may be anywhere
+		lines := opts.Lines
+		if !opts.Since.IsZero() {
+			lines = 0
+		}
+		data, err := readLastLines(path, info.Size(), lines)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, parseLogLines(data, info.ModTime()))
+	}
+
+	if !found && !opts.Follow {
+		return nil, notFound
+	}
+
+	lines := mergeLogLines(files)
+	if !opts.Since.IsZero() {
+		var since []logLine
+		for _, line := range lines {
+			if !line.time.Before(opts.Since) {
+				since = append(since, line)
+			}
+		}
+		lines = since
+	}
+	if opts.Lines > 0 && len(lines) > opts.Lines {
+		lines = lines[len(lines)-opts.Lines:]
+	}
+
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		for _, line := range lines {
+			if _, err := writer.Write(line.text); err != nil {
+				return
+			}
+		}
+		if !opts.Follow {
+			writer.Close()
+			return
+		}
+
+		// the files are checked until the reader is closed
+		ticker := time.NewTicker(logPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			for i, path := range paths {
+				offset, err := copyAppended(writer, path, offsets[i])
+				if err == io.ErrClosedPipe {
+					return
+				}
+				offsets[i] = offset
+			}
+		}
+	}()
+
+	return &logReader{PipeReader: reader, stop: func() { close(done) }}, nil
+}
+
+// logLine - line of the log file with its time
+type logLine struct {
+	time time.Time
+	text []byte
+}
+
+// Split the data of the log file to the lines, each line is terminated by
+// the line break. The lines without the time get the time of the previous
+// line, the first ones the time of the next line or the modification time
+// of the file if no line has the time.
+func parseLogLines(data []byte, modTime time.Time) []logLine {
+	var lines []logLine
+	var last time.Time
+	first := -1
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		text := data[:end]
+		data = data[end:]
+		if text[len(text)-1] != '\n' {
+			// the files are not mixed in the same line
+			text = append(text[:len(text):len(text)], '\n')
+		}
+
+		if t, ok := logLineTime(text); ok {
+			if first < 0 {
+				first = len(lines)
+			}
+			last = t
+		}
+		lines = append(lines, logLine{time: last, text: text})
+	}
+
+	leading := modTime
+	if first >= 0 {
+		leading = lines[first].time
+	} else {
+		first = len(lines)
+	}
+	for i := 0; i < first; i++ {
+		lines[i].time = leading
+	}
+	return lines
+}
+
+// Length of the prefix of the log line which may contain the time
+const logTimePrefix = 64
+
+// Layouts of the time at the start of the log line
+var logTimeLayouts = []struct {
+	layout string
+	fields int
+}{
+	{time.RFC3339, 1},
+	{"2006/01/02 15:04:05", 2},
+}
+
+// Get the time of the log line from its prefix, the RFC 3339 time, e.g. of
+// the journal or "time=" of slog, or the time of the standard logger in
+// the local time zone
+func logLineTime(line []byte) (time.Time, bool) {
+	if len(line) > logTimePrefix {
+		line = line[:logTimePrefix]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	fields[0] = strings.TrimPrefix(fields[0], "time=")
+
+	for _, layout := range logTimeLayouts {
+		if len(fields) < layout.fields {
+			continue
+		}
+		value := strings.Join(fields[:layout.fields], " ")
+		if t, err := time.ParseInLocation(layout.layout, value, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Merge the lines of the log files by their time, the order of the lines of
+// the same file is kept
+func mergeLogLines(files [][]logLine) []logLine {
+	var merged []logLine
+	for {
+		next := -1
+		for i, lines := range files {
+			if len(lines) > 0 && (next < 0 || lines[0].time.Before(files[next][0].time)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return merged
+		}
+		merged = append(merged, files[next][0])
+		files[next] = files[next][1:]
+	}
+}
+
+// Read the last lines of the file of the size, all the file if lines is zero
+func readLastLines(path string, size int64, lines int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if lines <= 0 {
+		return ioutil.ReadAll(io.LimitReader(file, size))
+	}
+
+	// the blocks are read from the end until there are enough lines,
+	// the last line may be not terminated
+	var data []byte
+	offset := size
+	for offset > 0 && bytes.Count(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) < lines {
+		n := int64(logBlockSize)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+
+		block := make([]byte, n)
+		if _, err := file.ReadAt(block, offset); err != nil {
+			return nil, err
+		}
+		data = append(block, data...)
+	}
+
+	trimmed := bytes.TrimSuffix(data, []byte("\n"))
+	for i := 0; i < lines; i++ {
+		pos := bytes.LastIndexByte(trimmed, '\n')
+		if pos < 0 {
+			return data, nil
+		}
+		trimmed = trimmed[:pos]
+	}
+
+	return data[len(trimmed)+1:], nil
+}
+
+// Copy the data appended to the file after the offset and get the new
+// offset, the file is read from the start if it has been truncated
+func copyAppended(w io.Writer, path string, offset int64) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() == offset {
+		return offset, nil
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	n, err := io.Copy(w, io.LimitReader(file, info.Size()-offset))
+	return offset + n, err
+}
+
+// logReader - reader of the service log, closing of the reader stops the
+// reading of the log
+type logReader struct {
+	*io.PipeReader
+	stop     func()
+	stopOnce sync.Once
+}
+
+// Close the reader and stop the reading of the log, the reading is stopped
+// once if the reader is closed again
+func (r *logReader) Close() error {
+	err := r.PipeReader.Close()
+	if r.stop != nil {
+		r.stopOnce.Do(r.stop)
+	}
+	return err
+}
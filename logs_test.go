@@ -0,0 +1,173 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Write the log files of the service and get their paths
+func writeLogFiles(t *testing.T, output, errors string, modTime time.Time) []string {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "service.log"), filepath.Join(dir, "service.err")}
+	for i, content := range []string{output, errors} {
+		if err := ioutil.WriteFile(paths[i], []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(paths[i], modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestFileLogs(t *testing.T) {
+	output := "2020/01/02 10:00:00 started\n" +
+		"2020/01/02 10:00:02 request\n" +
+		"details of the request\n" +
+		"2020/01/02 10:00:04 stopped\n"
+	errors := "2020/01/02 10:00:01 warning\n" +
+		"2020/01/02 10:00:03 failure"
+
+	modTime := time.Date(2020, 1, 2, 10, 0, 5, 0, time.Local)
+
+	tests := []struct {
+		name string
+		opts LogOptions
+		want string
+	}{
+		{
+			name: "all",
+			want: "2020/01/02 10:00:00 started\n" +
+				"2020/01/02 10:00:01 warning\n" +
+				"2020/01/02 10:00:02 request\n" +
+				"details of the request\n" +
+				"2020/01/02 10:00:03 failure\n" +
+				"2020/01/02 10:00:04 stopped\n",
+		},
+		{
+			name: "lines",
+			opts: LogOptions{Lines: 3},
+			want: "details of the request\n" +
+				"2020/01/02 10:00:03 failure\n" +
+				"2020/01/02 10:00:04 stopped\n",
+		},
+		{
+			name: "since",
+			opts: LogOptions{Since: time.Date(2020, 1, 2, 10, 0, 2, 0, time.Local)},
+			want: "2020/01/02 10:00:02 request\n" +
+				"details of the request\n" +
+				"2020/01/02 10:00:03 failure\n" +
+				"2020/01/02 10:00:04 stopped\n",
+		},
+		{
+			name: "since and lines",
+			opts: LogOptions{Since: time.Date(2020, 1, 2, 10, 0, 1, 0, time.Local), Lines: 2},
+			want: "2020/01/02 10:00:03 failure\n" +
+				"2020/01/02 10:00:04 stopped\n",
+		},
+		{
+			name: "since modification",
+			opts: LogOptions{Since: modTime.Add(time.Second)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := fileLogs(writeLogFiles(t, output, errors, modTime), test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("log:\n%s\nwant:\n%s", data, test.want)
+			}
+		})
+	}
+}
+
+func TestFileLogsFollow(t *testing.T) {
+	paths := writeLogFiles(t, "2020/01/02 10:00:00 started\n", "", time.Now())
+	goroutines := runtime.NumGoroutine()
+
+	reader, err := fileLogs(paths, LogOptions{Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewReader(reader)
+
+	// the whole log is given before the new lines
+	if line, err := lines.ReadString('\n'); err != nil || line != "2020/01/02 10:00:00 started\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+
+	file, err := os.OpenFile(paths[1], os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("2020/01/02 10:00:01 warning\n")
+	file.Close()
+	if line, err := lines.ReadString('\n'); err != nil || line != "2020/01/02 10:00:01 warning\n" {
+		t.Fatalf("appended line = %q, %v", line, err)
+	}
+
+	// the files are not checked anymore after the reader is closed, it
+	// may be closed again
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > goroutines; {
+		if time.Now().After(deadline) {
+			t.Fatal("log files are followed after the reader is closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseLogLines(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	data := "first\n" +
+		"2020-01-02T11:00:00Z second\n" +
+		"third\n" +
+		"time=2020-01-02T12:00:00.5Z level=INFO msg=fourth"
+
+	lines := parseLogLines([]byte(data), modTime)
+	want := []struct {
+		time time.Time
+		text string
+	}{
+		{time.Date(2020, 1, 2, 11, 0, 0, 0, time.UTC), "first\n"},
+		{time.Date(2020, 1, 2, 11, 0, 0, 0, time.UTC), "2020-01-02T11:00:00Z second\n"},
+		{time.Date(2020, 1, 2, 11, 0, 0, 0, time.UTC), "third\n"},
+		{time.Date(2020, 1, 2, 12, 0, 0, 500000000, time.UTC), "time=2020-01-02T12:00:00.5Z level=INFO msg=fourth\n"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("parseLogLines() = %d lines; want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		if !line.time.Equal(want[i].time) || string(line.text) != want[i].text {
+			t.Errorf("line %d = %v %q; want %v %q", i, line.time, line.text, want[i].time, want[i].text)
+		}
+	}
+
+	// the time of the file is used if no line has the time
+	for _, line := range parseLogLines([]byte("first\nsecond\n"), modTime) {
+		if !line.time.Equal(modTime) {
+			t.Errorf("%q time = %v; want %v", line.text, line.time, modTime)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit codes returned by Manage
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// Command is an additional command of the service handled by Manage
+type Command struct {
+	// Name of the command given as the first argument
+	Name string
+
+	// Usage - short description of the command shown in the usage message
+	Usage string
+
+	// Run - run the command with the rest of arguments
+	Run func(args []string) (string, error)
+}
+
+// Manage - manage the service by the command given in arguments (without the
+// program name, i.e. os.Args[1:]): install, remove, start, stop, restart,
+// reload, enable, disable, status, logs, plan or run. The service is run if
+// there is no command. The arguments after install are passed to the service
+// when it is started by the system. The logs command prints the service log,
+// "logs -n 20 -since 1h -f" prints the last 20 lines of the last hour and
+// follows the log. The plan command prints the changes made by
+// "install [args]" or "remove" without applying them. If the service is
+// created with WithElevation and the command fails for the lack of root
+// privileges, the program is run again with the same arguments by sudo.
+// Additional commands are checked first, so they may replace the standard
+// ones. Manage prints the result and returns the exit code for the process:
+//
+//	os.Exit(daemon.Manage(service, executable, os.Args[1:]))
+func Manage(d Daemon, e Executable, args []string, commands ...Command) int {
+	return manage(d, func() (string, error) { return d.Run(e) }, args, commands)
+}
+
+// ManageContext - manage the service the same way as Manage, the context-aware
+// executable is run by RunContext
+func ManageContext(d Daemon, e ExecutableContext, args []string, commands ...Command) int {
+	return manage(d, func() (string, error) { return d.RunContext(e) }, args, commands)
+}
+
+// Dispatch the command and print its result
+func manage(d Daemon, run func() (string, error), args []string, commands []Command) int {
+	// the program is re-executed with the same arguments if the command
+	// requires root privileges and the elevation is enabled
+	original := args
+	result := func(status string, err error) int {
+		if errors.Is(err, ErrRootPrivileges) && elevationEnabled(d) {
+			if code, elevateErr := elevate(original); elevateErr == nil {
+				return code
+			}
+		}
+		return report(status, err)
+	}
+
+	command := "run"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	for _, c := range commands {
+		if c.Name == command {
+			return result(c.Run(args))
+		}
+	}
+
+	switch command {
+	case "install":
+		return result(d.Install(args...))
+	case "remove":
+		return result(d.Remove())
+	case "start":
+		return result(d.Start())
+	case "stop":
+		return result(d.Stop())
+	case "restart":
+		return result(d.Restart())
+	case "reload":
+		return result(d.Reload())
+	case "enable":
+		return result(d.Enable())
+	case "disable":
+		return result(d.Disable())
+	case "status":
+		return result(d.Status())
+	case "logs":
+		if status, err := logs(d, args); err != nil {
+			return result(status, err)
+		}
+		return exitSuccess
+	case "plan":
+		return result(plan(d, args))
+	case "run":
+		return result(run())
+	case "help", "-h", "-help", "--help":
+		fmt.Println(usage(commands))
+		return exitSuccess
+	}
+
+	fmt.Fprintln(os.Stderr, usage(commands))
+	return exitUsage
+}
+
+// Print the service log selected by the arguments: -n lines, -since duration
+// and -f to follow the log
+func logs(d Daemon, args []string) (string, error) {
+	logsAction := "Logs:"
+
+	var opts LogOptions
+	var since time.Duration
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	flags.IntVar(&opts.Lines, "n", 0, "number of the last lines")
+	flags.DurationVar(&since, "since", 0, "only the lines of the last duration")
+	flags.BoolVar(&opts.Follow, "f", false, "follow the log")
+	if err := flags.Parse(args); err != nil {
+		return logsAction + failed, err
+	}
+	if since > 0 {
+		opts.Since = time.Now().Add(-since)
+	}
+
+	reader, err := d.Logs(opts)
+	if err != nil {
+		return logsAction + failed, err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(os.Stdout, reader); err != nil {
+		return logsAction + failed, err
+	}
+	return "", nil
+}
+
+// Get the description of the changes made by install or remove
+func plan(d Daemon, args []string) (string, error) {
+	planner, ok := d.(Planner)
+	if !ok {
+		return "Plan:" + failed, ErrUnsupported
+	}
+
+	var p Plan
+	var err error
+	switch {
+	case len(args) > 0 && args[0] == "remove":
+		p, err = planner.PlanRemove()
+	case len(args) > 0 && args[0] == "install":
+		p, err = planner.PlanInstall(args[1:]...)
+	default:
+		p, err = planner.PlanInstall(args...)
+	}
+	if err != nil {
+		return "Plan:" + failed, err
+	}
+
+	return p.String(), nil
+}
+
+// Print the result of the command and get the exit code, the status is
+// colored for terminals
+func report(status string, err error) int {
+	if err != nil {
+		if colorEnabled(os.Stderr) {
+			status = Colorize(status)
+		}
+		fmt.Fprintln(os.Stderr, status, "\nError: ", err)
+		return exitFailure
+	}
+	if colorEnabled(os.Stdout) {
+		status = Colorize(status)
+	}
+	fmt.Println(status)
+	return exitSuccess
+}
+
+// Get the usage message of the service
+func usage(commands []Command) string {
+	names := []string{"install", "remove", "start", "stop", "restart", "reload", "enable", "disable", "status", "logs", "plan", "run"}
+	for _, c := range commands {
+		if !strings.Contains(" "+strings.Join(names, " ")+" ", " "+c.Name+" ") {
+			names = append(names, c.Name)
+		}
+	}
+
+	text := "Usage: " + filepath.Base(os.Args[0]) + " " + strings.Join(names, " | ")
+	for _, c := range commands {
+		if c.Usage != "" {
+			text += "\n  " + c.Name + "\t" + c.Usage
+		}
+	}
+
+	return text
+}
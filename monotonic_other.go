@@ -0,0 +1,14 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !linux
+
+package daemon
+
+import "time"
+
+// Get the time of the monotonic clock, false if it can not be read
+func monotonicNow() (time.Duration, bool) {
+	return 0, false
+}
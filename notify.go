@@ -0,0 +1,100 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Service states of the notification protocol of systemd, see sd_notify(3)
+const (
+	// NotifyReady - the service startup is finished
+	NotifyReady = "READY=1"
+
+	// NotifyReloading - the service is reloading its configuration
+	NotifyReloading = "RELOADING=1"
+
+	// NotifyStopping - the service is beginning its shutdown
+	NotifyStopping = "STOPPING=1"
+
+	// NotifyWatchdog - keep-alive ping for the service watchdog
+	NotifyWatchdog = "WATCHDOG=1"
+)
+
+// Notify sends the state of the service to the service manager through the
+// datagram socket given in the NOTIFY_SOCKET environment variable. Several
+// states may be sent at once separated by newlines. It returns false if the
+// service manager does not expect notifications.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// NotifyStatus sends a free-form status text of the service to the service
+// manager
+func NotifyStatus(status string) (bool, error) {
+	return Notify("STATUS=" + status)
+}
+
+// WatchdogInterval returns the interval in which the service manager expects
+// watchdog pings from the service, zero if the watchdog is not enabled for
+// this process
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	interval, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(interval) * time.Microsecond, nil
+}
+
+// Start sending watchdog pings to the service manager in the background until
+// the returned channel is closed
+func startWatchdog() chan<- struct{} {
+	done := make(chan struct{})
+	interval, err := WatchdogInterval()
+	if err != nil || interval <= 0 {
+		return done
+	}
+
+	go func() {
+		// ping twice per interval to never miss the deadline
+		tick := time.NewTicker(interval / 2)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				Notify(NotifyWatchdog)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return done
+}
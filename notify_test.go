@@ -0,0 +1,132 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Bind the notification socket of the service manager
+func listenNotify(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+// Read the next notification
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no notification: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listenNotify(t)
+
+	if ok, err := Notify(NotifyReady); !ok || err != nil {
+		t.Fatalf("Notify() = %v, %v", ok, err)
+	}
+	if state := readNotify(t, conn); state != "READY=1" {
+		t.Errorf("notification = %q; want READY=1", state)
+	}
+
+	if ok, err := NotifyStatus("Serving"); !ok || err != nil {
+		t.Fatalf("NotifyStatus() = %v, %v", ok, err)
+	}
+	if state := readNotify(t, conn); state != "STATUS=Serving" {
+		t.Errorf("notification = %q; want STATUS=Serving", state)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if ok, err := Notify(NotifyReady); ok || err != nil {
+		t.Errorf("Notify() = %v, %v; want not sent", ok, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "1500000")
+	t.Setenv("WATCHDOG_PID", "")
+	if interval, err := WatchdogInterval(); interval != 1500*time.Millisecond || err != nil {
+		t.Errorf("WatchdogInterval() = %v, %v; want 1.5s", interval, err)
+	}
+
+	// the watchdog of another process
+	t.Setenv("WATCHDOG_PID", "1")
+	if interval, err := WatchdogInterval(); interval != 0 || err != nil {
+		t.Errorf("WatchdogInterval() of another process = %v, %v; want 0", interval, err)
+	}
+}
+
+// notifyExecutable - the executable which starts and stops immediately
+type notifyExecutable struct{}
+
+func (notifyExecutable) Start(ctx context.Context) error { return nil }
+func (notifyExecutable) Stop(ctx context.Context) error  { return nil }
+
+func TestRunExecutableNotify(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runExecutable("Test service", notifyExecutable{}, time.Second)
+	}()
+
+	if state := readNotify(t, conn); !strings.HasPrefix(state, "READY=1\n") {
+		t.Fatalf("notification = %q; want READY=1 first", state)
+	}
+	for i := 0; i < 2; i++ {
+		if state := readNotify(t, conn); state != "WATCHDOG=1" {
+			t.Fatalf("notification = %q; want WATCHDOG=1", state)
+		}
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pings may be sent until the termination signal is handled
+	for {
+		state := readNotify(t, conn)
+		if state == "STOPPING=1" {
+			break
+		}
+		if state != "WATCHDOG=1" {
+			t.Fatalf("notification = %q; want STOPPING=1", state)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("runExecutable() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runExecutable() does not return after SIGTERM")
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/takama/daemon/logfile"
+	"github.com/takama/daemon/syslog"
+)
+
+// Option configures an optional property of the service, see NewWithOptions
+type Option func(*config)
+
+// config - optional properties of the service collected from options
+type config struct {
+	dependencies []string
+	user         string
+	group        string
+	workDir      string
+	env          []string
+	notify       bool
+	watchdog     time.Duration
+	sockets      []string
+	stopTimeout  time.Duration
+	runner       CommandRunner
+	host         hostSystem
+	root         string
+	linger       bool
+	elevate      bool
+	dbus         bool
+	dbusAddress  string
+	syslog       bool
+	facility     syslog.Facility
+	logFile      string
+	logRotation  logfile.Options
+	logrotate    *LogRotation
+}
+
+// LogRotation - rotation of the log files of the service by logrotate, see
+// WithLogRotation
+type LogRotation struct {
+	// Schedule - daily, weekly, monthly or yearly, the files are rotated
+	// by the size only if it is empty and the size is set, daily otherwise
+	Schedule string
+
+	// Size - the files are rotated when they are larger, e.g. "100M"
+	Size string
+
+	// Rotate - number of the kept rotated files, 7 if zero
+	Rotate int
+
+	// Compress - compress the rotated files
+	Compress bool
+
+	// Signal - signal sent to the service after the rotation, e.g. "HUP",
+	// the files are copied and truncated instead if it is empty, as the
+	// service keeps writing to the open files
+	Signal string
+}
+
+// WithDependencies - services which should be started before the service
+func WithDependencies(dependencies ...string) Option {
+	return func(c *config) {
+		c.dependencies = append(c.dependencies, dependencies...)
+	}
+}
+
+// WithUser - user account the service runs as. Valid for Linux SystemDaemon
+// only, UserService runs as the current user.
+func WithUser(user string) Option {
+	return func(c *config) {
+		c.user = user
+	}
+}
+
+// WithGroup - group the service runs as. Valid for Linux SystemDaemon only.
+func WithGroup(group string) Option {
+	return func(c *config) {
+		c.group = group
+	}
+}
+
+// WithWorkDir - working directory of the service. Valid for Linux only.
+func WithWorkDir(dir string) Option {
+	return func(c *config) {
+		c.workDir = dir
+	}
+}
+
+// WithEnv - environment variables of the service in "KEY=VALUE" form.
+// Valid for Linux only.
+func WithEnv(env ...string) Option {
+	return func(c *config) {
+		c.env = append(c.env, env...)
+	}
+}
+
+// WithNotify - the service notifies the service manager when its startup is
+// finished (systemd Type=notify), Run sends the notification after the start
+// of the executable. Valid for Linux systemd only.
+func WithNotify() Option {
+	return func(c *config) {
+		c.notify = true
+	}
+}
+
+// WithWatchdog - the service manager restarts the service if it does not
+// receive a keep-alive ping within the interval (systemd WatchdogSec), Run
+// sends the pings while the executable is running. It implies WithNotify.
+// Valid for Linux systemd only.
+func WithWatchdog(interval time.Duration) Option {
+	return func(c *config) {
+		c.notify = true
+		c.watchdog = interval
+	}
+}
+
+// WithSocket - the service is started by systemd socket activation on the
+// listen addresses, Install creates a socket unit per address next to the
+// service unit. The addresses are TCP addresses like ":9977" or paths of unix
+// sockets, the service gets the sockets with Listen(name, addr), where name
+// is the service name and addr is the same address. Valid for Linux systemd
+// only.
+func WithSocket(addrs ...string) Option {
+	return func(c *config) {
+		c.sockets = append(c.sockets, addrs...)
+	}
+}
+
+// WithStopTimeout - time given to the executable to stop after the service
+// receives a termination signal (or the stop request of the windows service
+// manager) in Run, 10 seconds by default.
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.stopTimeout = timeout
+	}
+}
+
+// WithRunner - runner of the external commands of the service manager, the
+// commands are run by os/exec by default. Valid for Linux, FreeBSD and macOS
+// only.
+func WithRunner(runner CommandRunner) Option {
+	return func(c *config) {
+		c.runner = runner
+	}
+}
+
+// WithRoot - alternate root directory of the file system, where the service
+// files (unit files, init scripts, rc links) are created by Install and
+// removed by Remove, e.g. to build images or to provision chroots. The paths
+// written into the files stay relative to the system root. Valid for Linux,
+// FreeBSD and macOS only.
+func WithRoot(dir string) Option {
+	return func(c *config) {
+		c.root = dir
+	}
+}
+
+// WithLinger - Install enables lingering of the user (loginctl enable-linger),
+// so the user services are started on boot and keep running after the user
+// logs out. Valid for Linux UserService only.
+func WithLinger() Option {
+	return func(c *config) {
+		c.linger = true
+	}
+}
+
+// WithElevation - Manage runs the program again with the same arguments by
+// sudo (or pkexec) if the command requires root privileges, so the command
+// works interactively for a normal user. The exit code and the output of the
+// elevated program are passed through. Valid for Linux, FreeBSD and macOS
+// only.
+func WithElevation() Option {
+	return func(c *config) {
+		c.elevate = true
+	}
+}
+
+// WithDBus - the service is managed by the methods of systemd called over
+// D-Bus instead of running systemctl. The address of the bus is given like
+// "unix:path=/run/dbus/system_bus_socket", the system bus (or the bus of the
+// user for UserService) is used if the address is empty. The jobs starting
+// and stopping the units are waited for the stop timeout and 5 seconds at
+// most, see WithStopTimeout. Valid for Linux systemd only.
+func WithDBus(address string) Option {
+	return func(c *config) {
+		c.dbus = true
+		c.dbusAddress = address
+	}
+}
+
+// WithSyslog - Run sends the log of the service (the standard logger and the
+// default slog logger) to the local syslog daemon in the RFC 5424 format with
+// the daemon facility, see package syslog.
+func WithSyslog() Option {
+	return func(c *config) {
+		c.syslog = true
+	}
+}
+
+// WithSyslogFacility - like WithSyslog, the messages are sent with the
+// facility, e.g. syslog.FacilityLocal0 for the rules of the syslog daemon
+// which select the log of the service.
+func WithSyslogFacility(facility syslog.Facility) Option {
+	return func(c *config) {
+		c.syslog = true
+		c.facility = facility
+	}
+}
+
+// WithLogFile - Run writes the log of the service (the standard logger and
+// the default slog logger) to the file, which is rotated, compressed and
+// removed by the options, see package logfile.
+func WithLogFile(path string, opts logfile.Options) Option {
+	return func(c *config) {
+		c.logFile = path
+		c.logRotation = opts
+	}
+}
+
+// WithLogRotation - Install writes the logrotate configuration of the log
+// files of the service (/etc/logrotate.d/<name>), Remove removes it. Valid
+// for Linux SysV and upstart only, systemd keeps the output in the journal.
+func WithLogRotation(rotation LogRotation) Option {
+	return func(c *config) {
+		c.logrotate = &rotation
+	}
+}
+
+// Path of the system file in the alternate root directory
+func (c *config) path(name string) string {
+	if c.root == "" {
+		return name
+	}
+	return filepath.Join(c.root, name)
+}
+
+// Create the directory of the file in the alternate root directory, the
+// directories of the system root are expected to exist
+func (c *config) makeDir(name string) error {
+	if c.root == "" {
+		return nil
+	}
+	return os.MkdirAll(filepath.Dir(name), 0755)
+}
+
+// Names of the users and groups, the portable names and the numeric IDs
+var accountName = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.-]*\$?|[0-9]+)$`)
+
+// Names of the environment variables
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Check the values of the options which are written to the service files,
+// the values are quoted in the files, but the names and the paths must be
+// valid and no value may break the line
+func (c *config) validate(name, description string, kind Kind) error {
+	if name == "" || strings.ContainsRune(name, '/') || hasControl(name) {
+		return fmt.Errorf("Invalid service name %q", name)
+	}
+	if hasControl(description) {
+		return fmt.Errorf("Invalid service description %q", description)
+	}
+	// the user services run as the user of the service manager
+	if kind == UserService && (c.user != "" || c.group != "") {
+		return errors.New("The user and the group can not be set for the user service")
+	}
+	if c.user != "" && !accountName.MatchString(c.user) {
+		return fmt.Errorf("Invalid user name %q", c.user)
+	}
+	if c.group != "" && !accountName.MatchString(c.group) {
+		return fmt.Errorf("Invalid group name %q", c.group)
+	}
+	if c.workDir != "" && (!filepath.IsAbs(c.workDir) || hasControl(c.workDir)) {
+		return fmt.Errorf("Invalid working directory %q, the absolute path is expected", c.workDir)
+	}
+	for _, env := range c.env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !envName.MatchString(parts[0]) || hasControl(parts[1]) {
+			return fmt.Errorf("Invalid environment variable %q, KEY=VALUE is expected", env)
+		}
+	}
+	for _, dependency := range c.dependencies {
+		if strings.ContainsRune(dependency, ' ') || hasControl(dependency) {
+			return fmt.Errorf("Invalid dependency %q", dependency)
+		}
+	}
+	for _, addr := range c.sockets {
+		if addr == "" || strings.ContainsRune(addr, ' ') || hasControl(addr) {
+			return fmt.Errorf("Invalid listen address %q", addr)
+		}
+	}
+	return nil
+}
+
+// Does the string contain the control characters, e.g. the line breaks
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return r < ' ' || r == 0x7f
+	}) >= 0
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import "testing"
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		cfg     config
+		kind    Kind
+		valid   bool
+	}{
+		{"defaults", "test", config{}, SystemDaemon, true},
+		{"all options", "test", config{
+			user: "svc-user", group: "svc", workDir: "/var/lib/svc dir",
+			env: []string{"PORT=9977", "EMPTY=", "QUOTED=it's \"ok\" 100%"}, dependencies: []string{"network.target"},
+			sockets: []string{":9977", "/run/test.sock"},
+		}, SystemDaemon, true},
+		{"numeric user", "test", config{user: "1000", group: "1000"}, SystemDaemon, true},
+		{"machine account", "test", config{user: "host$"}, SystemDaemon, true},
+		{"empty name", "", config{}, SystemDaemon, false},
+		{"name with slash", "a/b", config{}, SystemDaemon, false},
+		{"user with space", "test", config{user: "svc user"}, SystemDaemon, false},
+		{"user with quote", "test", config{user: `svc"`}, SystemDaemon, false},
+		{"user with newline", "test", config{user: "svc\nexec /bin/sh"}, SystemDaemon, false},
+		{"group with semicolon", "test", config{group: "svc;id"}, SystemDaemon, false},
+		{"relative work dir", "test", config{workDir: "svc"}, SystemDaemon, false},
+		{"work dir with newline", "test", config{workDir: "/srv\nUser=root"}, SystemDaemon, false},
+		{"env without value", "test", config{env: []string{"PORT"}}, SystemDaemon, false},
+		{"env with invalid name", "test", config{env: []string{"MY-PORT=1"}}, SystemDaemon, false},
+		{"env with newline", "test", config{env: []string{"PORT=1\nUser=root"}}, SystemDaemon, false},
+		{"dependency with space", "test", config{dependencies: []string{"a b"}}, SystemDaemon, false},
+		{"user of user service", "test", config{user: "svc"}, UserService, false},
+		{"group of user service", "test", config{group: "svc"}, UserService, false},
+		{"user service", "test", config{workDir: "/srv"}, UserService, true},
+		{"socket with newline", "test", config{sockets: []string{":80\nExecStartPre=/bin/sh"}}, SystemDaemon, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cfg.validate(test.service, "Test service", test.kind)
+			if (err == nil) != test.valid {
+				t.Errorf("validate() error = %v; want valid %v", err, test.valid)
+			}
+		})
+	}
+
+	if err := (&config{}).validate("test", "Test\nservice", SystemDaemon); err == nil {
+		t.Error("validate() of the description with newline succeeded")
+	}
+}
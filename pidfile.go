@@ -0,0 +1,185 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Lock the pid file of the service run by Run, so the second instance of the
+// service gets ErrAlreadyRunning. The returned function removes the file. The
+// pid file is not used if it can not be created, e.g. the service runs as a
+// normal user, the user services keep it in XDG_RUNTIME_DIR.
+func (c *config) runPidFile(name string, kind Kind) (func() error, error) {
+	path := c.pidFile(name)
+	if kind == UserService {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return func() error { return nil }, nil
+		}
+		path = filepath.Join(dir, name+".pid")
+	}
+
+	release, err := lockPidFile(path)
+	if errors.Is(err, ErrAlreadyRunning) {
+		return nil, err
+	}
+	if err != nil {
+		return func() error { return nil }, nil
+	}
+
+	return release, nil
+}
+
+// Create the pid file with the pid of the process and lock it until the
+// returned function is called. The file which can not be removed, e.g. the
+// service runs as the user who may not change /var/run, is emptied, so it
+// does not keep the pid. The pid of the former instance which does not
+// lock the file is checked by /proc/<pid>/exe, the pid of another program is
+// stale.
+func lockPidFile(path string) (func() error, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			file.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, ErrAlreadyRunning
+			}
+			return nil, err
+		}
+
+		// the file may have been removed by the former instance before
+		// it was locked, then the new file is locked
+		if !samePidFile(file, path) {
+			file.Close()
+			continue
+		}
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid > 0 && pid != os.Getpid() && processAlive(pid) && sameExecutable(pid) {
+			file.Close()
+			return nil, ErrAlreadyRunning
+		}
+
+		if err := file.Truncate(0); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if _, err := file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		return func() error {
+			defer file.Close()
+
+			// the file is removed while it is locked, unless it has
+			// been replaced by somebody else
+			if !samePidFile(file, path) {
+				return nil
+			}
+			if err := removeFile(path); err != nil {
+				// the emptied file does not keep the stale pid
+				if truncErr := file.Truncate(0); truncErr != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	}
+}
+
+// Remove the file, replaced in tests
+var removeFile = os.Remove
+
+// Is the open file the one at the path
+func samePidFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, current)
+}
+
+// Is the process running the same executable as this one, true if it is
+// unknown
+func sameExecutable(pid int) bool {
+	exe, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+	if err != nil {
+		return true
+	}
+	// the executable may have been replaced by the upgrade
+	exe = strings.TrimSuffix(exe, " (deleted)")
+
+	self, err := os.Executable()
+	if err != nil {
+		return true
+	}
+	if resolved, err := filepath.EvalSymlinks(self); err == nil {
+		self = resolved
+	}
+
+	return exe == self
+}
+
+// Path of the pid file of the service in the alternate root directory
+func (c *config) pidFile(name string) string {
+	return c.path(filepath.Join("/var/run", name+".pid"))
+}
+
+// Get the pid of the running service from the pid file, zero if the
+// process is not running
+func readPidFile(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || !processAlive(pid) {
+		return 0
+	}
+	return pid
+}
+
+// Is the process running, the zombies are not
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		// the system without /proc, the process of another user can not
+		// be signaled, but it exists
+		err := syscall.Kill(pid, 0)
+		return err == nil || err == syscall.EPERM
+	}
+	i := strings.LastIndexByte(string(stat), ')')
+	return i < 0 || !strings.HasPrefix(string(stat[i+1:]), " Z")
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package daemon
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestLockPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pid")
+
+	release, err := lockPidFile(path)
+	if err != nil {
+		t.Fatalf("lockPidFile() error = %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(os.Getpid()) + "\n"; string(data) != want {
+		t.Errorf("pid file = %q; want %q", data, want)
+	}
+
+	if err := release(); err != nil {
+		t.Errorf("release() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pid file exists after release (%v)", err)
+	}
+}
+
+func TestLockPidFileNotRemoved(t *testing.T) {
+	// the service which runs as the user can not remove the pid file from
+	// /var/run
+	errRemove := errors.New("permission denied")
+	removeFile = func(string) error { return errRemove }
+	defer func() { removeFile = os.Remove }()
+
+	path := filepath.Join(t.TempDir(), "test.pid")
+	release, err := lockPidFile(path)
+	if err != nil {
+		t.Fatalf("lockPidFile() error = %v", err)
+	}
+	if err := release(); err != nil {
+		t.Errorf("release() error = %v", err)
+	}
+
+	// the pid of the stopped service is not kept
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("pid file = %q; want empty", data)
+	}
+
+	// the next instance takes the emptied file
+	release, err = lockPidFile(path)
+	if err != nil {
+		t.Fatalf("lockPidFile() of the emptied file error = %v", err)
+	}
+	release()
+}
+
+func TestLockPidFileRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pid")
+	release, err := lockPidFile(path)
+	if err != nil {
+		t.Fatalf("lockPidFile() error = %v", err)
+	}
+	defer release()
+
+	if _, err := lockPidFile(path); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second lockPidFile() error = %v; want ErrAlreadyRunning", err)
+	}
+}
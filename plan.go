@@ -0,0 +1,305 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Planner is implemented by the services which can describe the changes
+// made by Install and Remove without applying them (dry run). The plan is
+// the one Install and Remove apply. Valid for Linux, FreeBSD and macOS only.
+type Planner interface {
+	// PlanInstall - get the changes made by Install with the same arguments
+	PlanInstall(args ...string) (Plan, error)
+
+	// PlanRemove - get the changes made by Remove
+	PlanRemove() (Plan, error)
+}
+
+// StepKind - kind of the change made by a step of the plan
+type StepKind int
+
+// Kinds of the plan steps
+const (
+	// StepWriteFile - the file is created with the content and the mode
+	StepWriteFile StepKind = iota
+	// StepSymlink - the symbolic link to the target is created
+	StepSymlink
+	// StepRemove - the file or the link is removed
+	StepRemove
+	// StepCommand - the command of the service manager is run
+	StepCommand
+	// StepCreateFile - the empty file is created with the mode and the
+	// owner if it does not exist, the existing file is kept
+	StepCreateFile
+)
+
+// Step - single change of the system made by the plan
+type Step struct {
+	Kind StepKind
+
+	// Path of the written file, the created link or the removed file
+	Path string
+
+	// Content and Mode of the written file
+	Content string
+	Mode    os.FileMode
+
+	// Owner of the created file, "user" or "user:group", the owner is not
+	// changed in the alternate root directory
+	Owner string
+
+	// Target of the created link
+	Target string
+
+	// Command with its arguments
+	Command []string
+
+	// Optional - failure of the step does not fail the plan,
+	// e.g. the link already exists or the file is missing
+	Optional bool
+
+	// Undo - steps reverting the change, they are applied if a later
+	// step of the plan fails
+	Undo []Step
+}
+
+// Plan - changes of the system in the order they are applied
+type Plan struct {
+	Steps []Step
+}
+
+// String - short description of the step
+func (s Step) String() string {
+	switch s.Kind {
+	case StepWriteFile:
+		return fmt.Sprintf("write %s (%#o)", s.Path, s.Mode)
+	case StepSymlink:
+		return "link " + s.Path + " -> " + s.Target
+	case StepRemove:
+		return "remove " + s.Path
+	case StepCommand:
+		return "run " + strings.Join(s.Command, " ")
+	case StepCreateFile:
+		if s.Owner != "" {
+			return fmt.Sprintf("create %s (%#o, %s)", s.Path, s.Mode, s.Owner)
+		}
+		return fmt.Sprintf("create %s (%#o)", s.Path, s.Mode)
+	}
+	return "unknown step"
+}
+
+// String - description of the plan with the content of the written files
+func (p Plan) String() string {
+	var lines []string
+	for _, step := range p.Steps {
+		lines = append(lines, step.String())
+		if step.Kind == StepWriteFile {
+			for _, line := range strings.Split(strings.TrimRight(step.Content, "\n"), "\n") {
+				lines = append(lines, "    "+line)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Add the step with the steps reverting it
+func (p *Plan) add(step Step, undo ...Step) {
+	step.Undo = undo
+	p.Steps = append(p.Steps, step)
+}
+
+// Step writing the file
+func writeFileStep(path, content string, mode os.FileMode) Step {
+	return Step{Kind: StepWriteFile, Path: path, Content: content, Mode: mode}
+}
+
+// Step creating the link, existing links are kept
+func symlinkStep(target, path string) Step {
+	return Step{Kind: StepSymlink, Path: path, Target: target, Optional: true}
+}
+
+// Step removing the file
+func removeStep(path string, optional bool) Step {
+	return Step{Kind: StepRemove, Path: path, Optional: optional}
+}
+
+// Step creating the file owned by the user and the group, if they are set
+func createFileStep(path string, mode os.FileMode, user, group string) Step {
+	owner := user
+	if group != "" {
+		owner += ":" + group
+	}
+	return Step{Kind: StepCreateFile, Path: path, Mode: mode, Owner: owner}
+}
+
+// Step running the command
+func commandStep(name string, args ...string) Step {
+	return Step{Kind: StepCommand, Command: append([]string{name}, args...)}
+}
+
+// Apply the steps of the plan in order, if a step fails the changes made by
+// the applied steps are reverted in reverse order
+func (p Plan) apply(c *config) error {
+	var applied []Step
+	for _, step := range p.Steps {
+		if err := step.apply(c); err != nil {
+			if step.Optional {
+				continue
+			}
+			// the failed command may have made a part of the changes
+			if step.Kind == StepCommand {
+				applied = append(applied, step)
+			}
+			for i := len(applied) - 1; i >= 0; i-- {
+				for _, undo := range applied[i].Undo {
+					undo.apply(c)
+				}
+			}
+			return err
+		}
+		applied = append(applied, step)
+	}
+	return nil
+}
+
+// Apply the step
+func (s Step) apply(c *config) error {
+	switch s.Kind {
+	case StepWriteFile:
+		if err := c.makeDir(s.Path); err != nil {
+			return err
+		}
+		return writeFile(s.Path, []byte(s.Content), s.Mode)
+	case StepSymlink:
+		if err := c.makeDir(s.Path); err != nil {
+			return err
+		}
+		return os.Symlink(s.Target, s.Path)
+	case StepRemove:
+		return os.Remove(s.Path)
+	case StepCommand:
+		_, err := c.runner.Run(s.Command[0], s.Command[1:]...)
+		return err
+	case StepCreateFile:
+		if err := c.makeDir(s.Path); err != nil {
+			return err
+		}
+		return createFile(s.Path, s.Mode, s.Owner, c.root == "")
+	}
+	return fmt.Errorf("unknown step: %d", s.Kind)
+}
+
+// Create the file if it does not exist and change its owner, if the owner
+// is given and chown is true
+func createFile(path string, mode os.FileMode, owner string, chown bool) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if owner == "" || !chown {
+		return nil
+	}
+
+	uid, gid, err := lookupOwner(owner)
+	if err != nil {
+		return err
+	}
+	return file.Chown(uid, gid)
+}
+
+// Get the IDs of the owner "user" or "user:group", the primary group of
+// the user is used if the group is not given
+func lookupOwner(owner string) (int, int, error) {
+	parts := strings.SplitN(owner, ":", 2)
+
+	usr, err := user.Lookup(parts[0])
+	if _, ok := err.(user.UnknownUserError); ok {
+		usr, err = user.LookupId(parts[0])
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	gid := usr.Gid
+
+	if len(parts) == 2 {
+		grp, err := user.LookupGroup(parts[1])
+		if _, ok := err.(user.UnknownGroupError); ok {
+			grp, err = user.LookupGroupId(parts[1])
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		gid = grp.Gid
+	}
+
+	uidNumber, err := strconv.Atoi(usr.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gidNumber, err := strconv.Atoi(gid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uidNumber, gidNumber, nil
+}
+
+// Write the file atomically: the data is written to a temporary file in the
+// same directory, synced to the disk and renamed to the path, so the file is
+// never left half-written
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	file, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// the rename is durable when the directory is synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Linux capabilities required to manage the system services
+const (
+	capDACOverride = 1
+	capSysAdmin    = 21
+)
+
+// PrivilegeError appears if the service is managed without the required
+// privileges, it matches ErrRootPrivileges with errors.Is
+type PrivilegeError struct {
+	// Privilege - name of the missing privilege, "root" or the name
+	// of the Linux capability, e.g. "CAP_DAC_OVERRIDE"
+	Privilege string
+
+	// UID - effective user ID of the process
+	UID int
+}
+
+// Error - description of the missing privilege
+func (e *PrivilegeError) Error() string {
+	return "You must have root user privileges (missing " + e.Privilege +
+		", effective uid " + strconv.Itoa(e.UID) + "). Possibly using 'sudo' command should help"
+}
+
+// Unwrap - the error is a kind of ErrRootPrivileges
+func (e *PrivilegeError) Unwrap() error {
+	return ErrRootPrivileges
+}
+
+// hostSystem - source of the process credentials and of the files which
+// identify the init system, the tests replace it by the fake one
+type hostSystem interface {
+	// credentials - effective user ID and capabilities of the process,
+	// known is false if the capabilities are not available (not Linux)
+	credentials() (uid int, caps uint64, known bool)
+
+	// exists - the file exists if name is a path, the command is found
+	// in PATH otherwise
+	exists(name string) bool
+}
+
+// processSystem - the running process and its file system
+type processSystem struct{}
+
+func (processSystem) credentials() (int, uint64, bool) {
+	caps, known := effectiveCapabilities()
+	return os.Geteuid(), caps, known
+}
+
+func (processSystem) exists(name string) bool {
+	if !strings.ContainsRune(name, os.PathSeparator) {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// Get the host system of the config, the running process by default
+func (c config) hostSystem() hostSystem {
+	if c.host == nil {
+		return processSystem{}
+	}
+	return c.host
+}
+
+// Check root rights to use system service: the effective user must be root,
+// on Linux the effective capabilities of the process are checked as well,
+// so root without the capabilities (e.g. in a container) fails the check and
+// a user with the capabilities passes it
+func (c config) checkPrivileges() (bool, error) {
+	uid, caps, known := c.hostSystem().credentials()
+	if uid < 0 {
+		return false, ErrUnsupportedSystem
+	}
+
+	if !known {
+		if uid == 0 {
+			return true, nil
+		}
+		return false, &PrivilegeError{Privilege: "root", UID: uid}
+	}
+
+	if caps&(1<<capDACOverride) == 0 {
+		return false, &PrivilegeError{Privilege: "CAP_DAC_OVERRIDE", UID: uid}
+	}
+
+	if uid != 0 && caps&(1<<capSysAdmin) == 0 {
+		return false, &PrivilegeError{Privilege: "CAP_SYS_ADMIN", UID: uid}
+	}
+
+	return true, nil
+}
+
+// Check the privileges to change the service files, the files in the
+// alternate root directory are changed with the rights of the user
+func (c config) checkFilePrivileges() (bool, error) {
+	if c.root != "" {
+		return true, nil
+	}
+	return c.checkPrivileges()
+}
+
+// Get the effective capabilities of the process from /proc/self/status,
+// false if the capabilities are not available (not Linux)
+func effectiveCapabilities() (uint64, bool) {
+	if runtime.GOOS != "linux" {
+		return 0, false
+	}
+
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "CapEff:" {
+			caps, err := strconv.ParseUint(fields[1], 16, 64)
+			return caps, err == nil
+		}
+	}
+
+	return 0, false
+}
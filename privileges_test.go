@@ -0,0 +1,70 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckPrivileges(t *testing.T) {
+	const (
+		dacOverride = 1 << capDACOverride
+		sysAdmin    = 1 << capSysAdmin
+	)
+
+	tests := []struct {
+		name      string
+		host      FakeHost
+		ok        bool
+		privilege string
+	}{
+		{"root", FakeHost{UID: 0, Caps: dacOverride | sysAdmin, KnownCaps: true}, true, ""},
+		{"root without capabilities", FakeHost{UID: 0, KnownCaps: false}, true, ""},
+		{"root in container", FakeHost{UID: 0, Caps: sysAdmin, KnownCaps: true}, false, "CAP_DAC_OVERRIDE"},
+		{"user with CAP_SYS_ADMIN", FakeHost{UID: 1000, Caps: dacOverride | sysAdmin, KnownCaps: true}, true, ""},
+		{"user without CAP_SYS_ADMIN", FakeHost{UID: 1000, Caps: dacOverride, KnownCaps: true}, false, "CAP_SYS_ADMIN"},
+		{"user without privileges", FakeHost{UID: 1000, KnownCaps: true}, false, "CAP_DAC_OVERRIDE"},
+		{"user without capabilities", FakeHost{UID: 1000, KnownCaps: false}, false, "root"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			host := test.host
+			ok, err := config{host: &host}.checkPrivileges()
+			if ok != test.ok {
+				t.Fatalf("checkPrivileges() = %v, %v; want %v", ok, err, test.ok)
+			}
+			if test.ok {
+				if err != nil {
+					t.Fatalf("checkPrivileges() error = %v", err)
+				}
+				return
+			}
+
+			var privilegeErr *PrivilegeError
+			if !errors.As(err, &privilegeErr) {
+				t.Fatalf("checkPrivileges() error = %v; want PrivilegeError", err)
+			}
+			if privilegeErr.Privilege != test.privilege || privilegeErr.UID != host.UID {
+				t.Errorf("checkPrivileges() error = %+v; want %s of uid %d", privilegeErr, test.privilege, host.UID)
+			}
+			if !errors.Is(err, ErrRootPrivileges) {
+				t.Errorf("checkPrivileges() error %v is not ErrRootPrivileges", err)
+			}
+		})
+	}
+}
+
+func TestCheckFilePrivileges(t *testing.T) {
+	host := &FakeHost{UID: 1000, KnownCaps: true}
+
+	if ok, err := (config{host: host}).checkFilePrivileges(); ok || err == nil {
+		t.Errorf("checkFilePrivileges() = %v, %v; want privilege error", ok, err)
+	}
+	if ok, err := (config{host: host, root: t.TempDir()}).checkFilePrivileges(); !ok || err != nil {
+		t.Errorf("checkFilePrivileges() with root = %v, %v; want true", ok, err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// CommandRunner runs the external commands of the service manager, such as
+// systemctl or launchctl. It may be replaced by WithRunner, e.g. to record the
+// commands in tests (see package daemontest).
+type CommandRunner interface {
+	// Run the command and return its standard output, the error is returned
+	// if the command cannot be run or it exits with non-zero code. The error
+	// of the failed command should implement ExitCode() int.
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// StreamRunner is implemented by the runners which can run the commands
+// which do not finish by themselves, e.g. "journalctl -f" for the followed
+// log, the output is read while the command is running.
+type StreamRunner interface {
+	CommandRunner
+
+	// Stream - start the command and return the reader of its standard
+	// output, closing of the reader stops the command
+	Stream(name string, args ...string) (io.ReadCloser, error)
+}
+
+// Start the command by the runner and return the reader of its output
+func streamCommand(runner CommandRunner, name string, args ...string) (io.ReadCloser, error) {
+	if streamer, ok := runner.(StreamRunner); ok {
+		return streamer.Stream(name, args...)
+	}
+	return nil, fmt.Errorf("streaming of the %s output is not supported by the runner: %w", name, ErrUnsupported)
+}
+
+// execRunner - runs the commands by os/exec
+type execRunner struct{}
+
+func (execRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+func (execRunner) Stream(name string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command(name, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// commandReader - output of the running command, closing of the reader
+// kills the command
+type commandReader struct {
+	io.ReadCloser
+	cmd  *exec.Cmd
+	once sync.Once
+}
+
+// Close the output and stop the command, the reader may be closed again
+func (r *commandReader) Close() error {
+	r.once.Do(func() {
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	})
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build go1.21
+
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/takama/daemon/journal"
+	"github.com/takama/daemon/syslog"
+)
+
+// Log to the journal by the default slog logger, the standard logger writes
+// to it as well
+func useJournal(j *journal.Journal) {
+	slog.SetDefault(slog.New(journal.NewHandler(j, nil)))
+}
+
+// Log to the syslog daemon by the default slog logger, the standard logger
+// writes to it as well
+func useSyslog(w *syslog.Writer) {
+	slog.SetDefault(slog.New(syslog.NewHandler(w, nil)))
+}
@@ -0,0 +1,27 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !go1.21
+
+package daemon
+
+import (
+	"log"
+
+	"github.com/takama/daemon/journal"
+	"github.com/takama/daemon/syslog"
+)
+
+// Log to the journal by the standard logger, the journal adds the time itself
+func useJournal(j *journal.Journal) {
+	log.SetOutput(j)
+	log.SetFlags(0)
+}
+
+// Log to the syslog daemon by the standard logger, the message has the time
+// in its header
+func useSyslog(w *syslog.Writer) {
+	log.SetOutput(w)
+	log.SetFlags(0)
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"strconv"
+	"time"
+)
+
+// State of the service
+type State int
+
+const (
+	// StateNotInstalled - the service is not installed in the system
+	StateNotInstalled State = iota
+
+	// StateStopped - the service is installed but not running
+	StateStopped
+
+	// StateStarting - the service is being started
+	StateStarting
+
+	// StateRunning - the service is running
+	StateRunning
+
+	// StateFailed - the service has stopped with an error
+	StateFailed
+)
+
+// String returns a human readable name of the state
+func (state State) String() string {
+	switch state {
+	case StateNotInstalled:
+		return "not installed"
+	case StateStopped:
+		return "stopped"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// ServiceStatus - structured status of the service
+type ServiceStatus struct {
+	// State of the service
+	State State
+
+	// PID of the main process of the service, zero if it is not known
+	PID int
+
+	// Since - time when the service entered its current state, zero if it is
+	// not known
+	Since time.Time
+
+	// ExitCode of the last run of the main process, if it is known
+	ExitCode int
+
+	// SubState - state of the service specific to the service manager, e.g.
+	// "running", "auto-restart" or "dead" for systemd, empty if it is not known
+	SubState string
+
+	// Restarts - number of automatic restarts of the service by the service
+	// manager, if it is known
+	Restarts int
+
+	// Backend - name of the service manager, e.g. "systemd", "upstart"
+	Backend string
+}
+
+// String formats the status the same way as Status method of the daemon
+func (status ServiceStatus) String() string {
+	switch status.State {
+	case StateNotInstalled:
+		return statNotInstalled
+	case StateRunning:
+		if status.PID > 0 {
+			return "Service (pid  " + strconv.Itoa(status.PID) + ") is running..."
+		}
+		return "Service is running..."
+	case StateStarting:
+		return "Service is starting..."
+	case StateFailed:
+		if status.ExitCode != 0 {
+			return "Service has failed (exit code " + strconv.Itoa(status.ExitCode) + ")"
+		}
+		return "Service has failed"
+	}
+	return "Service is stopped"
+}
+
+// Format the service status as the Status method result
+func formatStatus(status ServiceStatus, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if status.State == StateNotInstalled {
+		return statNotInstalled, ErrNotInstalled
+	}
+	return status.String(), nil
+}
+
+// Get exit status of the finished command, zero if it is not known
+func exitStatus(err error) int {
+	if exiterr, ok := err.(interface{ ExitCode() int }); ok {
+		return exiterr.ExitCode()
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build go1.21
+
+package syslog
+
+import (
+	"log/slog"
+
+	"github.com/takama/daemon/internal/slogfields"
+)
+
+// Handler is the slog.Handler which sends the records to the syslog daemon,
+// the attributes become the fields of the messages, the attributes of the
+// groups are prefixed by the group names: group.key
+type Handler = slogfields.Handler
+
+// Fields of the structured data of the messages
+var handlerFormat = slogfields.Format{
+	Separator: ".",
+	Name:      fieldName,
+	File:      "source.file",
+	Line:      "source.line",
+	Func:      "source.func",
+}
+
+// NewHandler creates the handler of the writer, the default options log the
+// records of the info level and above
+func NewHandler(w *Writer, opts *slog.HandlerOptions) *Handler {
+	return slogfields.New(func(level slog.Level, message string, fields map[string]string) error {
+		return w.Send(priority(level), message, fields)
+	}, handlerFormat, opts)
+}
+
+// Get the syslog priority of the level
+func priority(level slog.Level) Priority {
+	switch {
+	case level >= slog.LevelError:
+		return PriErr
+	case level >= slog.LevelWarn:
+		return PriWarning
+	case level >= slog.LevelInfo:
+		return PriInfo
+	}
+	return PriDebug
+}
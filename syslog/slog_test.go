@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build go1.21,!windows
+
+package syslog
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  Priority
+	}{
+		{slog.LevelDebug - 4, PriDebug},
+		{slog.LevelDebug, PriDebug},
+		{slog.LevelInfo, PriInfo},
+		{slog.LevelInfo + 2, PriInfo},
+		{slog.LevelWarn, PriWarning},
+		{slog.LevelError, PriErr},
+		{slog.LevelError + 4, PriErr},
+	}
+
+	for _, test := range tests {
+		if got := priority(test.level); got != test.want {
+			t.Errorf("priority(%v) = %d; want %d", test.level, got, test.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	conn := listenDatagrams(t, path)
+
+	w, err := New("my.service", FacilityDaemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	logger := slog.New(NewHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	tests := []struct {
+		level slog.Level
+		want  string
+	}{
+		{slog.LevelDebug, `^<31>1 .* - \[fields@32473 request\.id="42"\] checked$`},
+		{slog.LevelInfo, `^<30>1 .* - \[fields@32473 request\.id="42"\] checked$`},
+		{slog.LevelWarn, `^<28>1 .* - \[fields@32473 request\.id="42"\] checked$`},
+		{slog.LevelError, `^<27>1 .* - \[fields@32473 request\.id="42"\] checked$`},
+	}
+
+	for _, test := range tests {
+		logger.WithGroup("request").Log(context.Background(), test.level, "checked", "id", 42)
+		if message := readMessage(t, conn); !regexp.MustCompile(test.want).MatchString(message) {
+			t.Errorf("%v: message = %q; want %s", test.level, message, test.want)
+		}
+	}
+}
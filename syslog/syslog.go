@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+// Package syslog provides logging of the services to the local syslog daemon
+// in the RFC 5424 format: the messages keep the severity, the name and the
+// pid of the service and the custom fields as the structured data.
+package syslog
+
+import (
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority of the message, the syslog severity
+type Priority int
+
+// Priorities of the messages
+const (
+	PriEmerg Priority = iota
+	PriAlert
+	PriCrit
+	PriErr
+	PriWarning
+	PriNotice
+	PriInfo
+	PriDebug
+)
+
+// Facility of the messages, the type of the program
+type Facility int
+
+// Facilities of the services
+const (
+	FacilityUser   Facility = 1
+	FacilityDaemon Facility = 3
+	FacilityLocal0 Facility = 16
+	FacilityLocal1 Facility = 17
+	FacilityLocal2 Facility = 18
+	FacilityLocal3 Facility = 19
+	FacilityLocal4 Facility = 20
+	FacilityLocal5 Facility = 21
+	FacilityLocal6 Facility = 22
+	FacilityLocal7 Facility = 23
+)
+
+// Sockets of the local syslog daemon
+var socketPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// ID of the structured data element of the fields, the enterprise number
+// is the one reserved for documentation by RFC 5612
+const fieldsID = "fields@32473"
+
+// Maximum length of the field name (SD-NAME)
+const maxFieldName = 32
+
+// Format of the message timestamp
+const timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Writer is the logger which sends the messages to the syslog daemon. It is
+// safe for concurrent use.
+type Writer struct {
+	appName  string
+	facility Facility
+	hostname string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	network string
+	path    string
+}
+
+// New creates the logger of the service connected to the local syslog
+// daemon, the messages are sent with the application name and the facility
+func New(appName string, facility Facility) (*Writer, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	w := &Writer{appName: appName, facility: facility, hostname: hostname}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Connect to the first available socket, by datagrams if possible
+func (w *Writer) connect() error {
+	var err error
+	for _, path := range socketPaths {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			conn, err = net.Dial(network, path)
+			if err == nil {
+				w.conn, w.network, w.path = conn, network, path
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// Send the message with the priority and the fields, the fields are sent as
+// the parameters of the structured data element "fields@32473"
+func (w *Writer) Send(priority Priority, message string, fields map[string]string) error {
+	var b strings.Builder
+	b.WriteString("<" + strconv.Itoa(int(w.facility)*8+int(priority)) + ">1 ")
+	b.WriteString(time.Now().Format(timestampFormat) + " ")
+	b.WriteString(header(w.hostname) + " " + header(w.appName) + " ")
+	b.WriteString(strconv.Itoa(os.Getpid()) + " - ")
+	b.WriteString(structuredData(fields) + " ")
+	b.WriteString(message)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := b.String()
+	if w.network == "unix" {
+		// the messages are separated by newlines in the stream
+		data = strings.Replace(data, "\n", " ", -1) + "\n"
+	}
+
+	if _, err := w.conn.Write([]byte(data)); err != nil {
+		// the syslog daemon may have been restarted
+		w.conn.Close()
+		if err := w.connect(); err != nil {
+			return err
+		}
+		_, err = w.conn.Write([]byte(data))
+		return err
+	}
+
+	return nil
+}
+
+// Write the message with the info priority, so the writer can be the
+// output of the standard logger
+func (w *Writer) Write(p []byte) (int, error) {
+	if err := w.Send(PriInfo, strings.TrimRight(string(p), "\n"), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close the connection to the syslog daemon
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.Close()
+}
+
+// Get the header field: printable characters without spaces, "-" if it is
+// empty
+func header(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// Get the structured data of the fields, "-" if there are no fields
+func structuredData(fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if fieldName(name) != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	sort.Strings(names)
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var b strings.Builder
+	b.WriteString("[" + fieldsID)
+	for _, name := range names {
+		b.WriteString(" " + fieldName(name) + `="` + escape.Replace(fields[name]) + `"`)
+	}
+	b.WriteString("]")
+
+	return b.String()
+}
+
+// Get the parameter name of the structured data: printable characters
+// except '=', ' ', ']' and '"'
+func fieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > maxFieldName {
+		name = name[:maxFieldName]
+	}
+	return name
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+//+build !windows
+
+package syslog
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Use the socket of the syslog daemon at the path, the first socket does not
+// exist
+func useSocket(t *testing.T, path string) {
+	saved := socketPaths
+	socketPaths = []string{filepath.Join(filepath.Dir(path), "missing"), path}
+	t.Cleanup(func() { socketPaths = saved })
+}
+
+// Bind the datagram socket of the syslog daemon
+func listenDatagrams(t *testing.T, path string) *net.UnixConn {
+	useSocket(t, path)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Read the next message
+func readMessage(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no message: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestSend(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	timestamp := `\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d)`
+
+	tests := []struct {
+		name     string
+		facility Facility
+		priority Priority
+		message  string
+		fields   map[string]string
+		want     string
+	}{
+		{
+			"no fields", FacilityDaemon, PriInfo, "started", nil,
+			`<30>1 ` + timestamp + ` ` + regexp.QuoteMeta(hostname) + ` my\.service ` + pid + ` - - started`,
+		},
+		{
+			"fields", FacilityDaemon, PriErr, "failed",
+			map[string]string{"request id": "42", "path": `C:\dir "x"]`},
+			`<27>1 ` + timestamp + ` \S+ my\.service ` + pid + ` - ` +
+				regexp.QuoteMeta(`[fields@32473 path="C:\\dir \"x\"\]" requestid="42"]`) + ` failed`,
+		},
+		{
+			"local facility", FacilityLocal0, PriDebug, "tick", nil,
+			`<135>1 ` + timestamp + ` \S+ my\.service ` + pid + ` - - tick`,
+		},
+		{
+			"multi-line message", FacilityUser, PriWarning, "first\nsecond", nil,
+			`<12>1 ` + timestamp + ` \S+ my\.service ` + pid + ` - - first\nsecond`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log")
+			conn := listenDatagrams(t, path)
+
+			w, err := New("my.service", test.facility)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			if err := w.Send(test.priority, test.message, test.fields); err != nil {
+				t.Fatal(err)
+			}
+			message := readMessage(t, conn)
+			if !regexp.MustCompile(`^` + test.want + `$`).MatchString(message) {
+				t.Errorf("message = %q; want %s", message, test.want)
+			}
+		})
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	useSocket(t, path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	w, err := New("my.service", FacilityDaemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := w.Send(PriInfo, "first\nsecond", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the messages are separated by newlines in the stream
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	scanner := bufio.NewScanner(conn)
+	for _, want := range []string{` - - first second$`, ` - - third$`} {
+		if !scanner.Scan() {
+			t.Fatalf("no message: %v", scanner.Err())
+		}
+		if !regexp.MustCompile(`^<30>1 .*` + want).MatchString(scanner.Text()) {
+			t.Errorf("message = %q; want %s", scanner.Text(), want)
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	conn := listenDatagrams(t, path)
+
+	w, err := New("my.service", FacilityDaemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Send(PriInfo, "before", nil); err != nil {
+		t.Fatal(err)
+	}
+	readMessage(t, conn)
+
+	// the syslog daemon is restarted and binds the new socket
+	conn.Close()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	conn = listenDatagrams(t, path)
+
+	if err := w.Send(PriInfo, "after", nil); err != nil {
+		t.Fatalf("Send() after the restart error = %v", err)
+	}
+	if message := readMessage(t, conn); !regexp.MustCompile(` - - after$`).MatchString(message) {
+		t.Errorf("message = %q; want after", message)
+	}
+
+	// the daemon is gone
+	conn.Close()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(PriInfo, "lost", nil); err == nil {
+		t.Error("Send() without the syslog daemon succeeded")
+	}
+}
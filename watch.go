@@ -0,0 +1,119 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by
+// license that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"time"
+)
+
+// Interval of the status checks of the watched service
+const watchInterval = time.Second
+
+// EventType - kind of the transition of the service state
+type EventType int
+
+const (
+	// EventStarted - the service has started
+	EventStarted EventType = iota
+
+	// EventStopped - the service has stopped
+	EventStopped
+
+	// EventFailed - the service has stopped with an error
+	EventFailed
+
+	// EventRestarted - the service has been restarted, its main process
+	// has changed
+	EventRestarted
+)
+
+// String returns a human readable name of the event type
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventStopped:
+		return "stopped"
+	case EventFailed:
+		return "failed"
+	case EventRestarted:
+		return "restarted"
+	}
+	return "unknown"
+}
+
+// StatusEvent - transition of the service state reported by Watch
+type StatusEvent struct {
+	// Type of the transition
+	Type EventType
+
+	// Status of the service after the transition, with the PID of the
+	// started process or the exit code of the stopped one, if they are known
+	Status ServiceStatus
+
+	// Previous status of the service
+	Previous ServiceStatus
+}
+
+// Detect the transition of the service state between the statuses
+func statusEvent(previous, current ServiceStatus) (StatusEvent, bool) {
+	event := StatusEvent{Status: current, Previous: previous}
+
+	switch {
+	case current.State == StateFailed && previous.State != StateFailed:
+		event.Type = EventFailed
+	case current.State == StateRunning && previous.State != StateRunning:
+		event.Type = EventStarted
+	case current.State == StateRunning && previous.PID != 0 && current.PID != previous.PID,
+		current.State == StateRunning && current.Restarts > previous.Restarts:
+		event.Type = EventRestarted
+	case previous.State == StateRunning && current.State != StateRunning &&
+		current.State != StateStarting:
+		event.Type = EventStopped
+	default:
+		return event, false
+	}
+
+	return event, true
+}
+
+// Watch the service by the periodic checks of its status, the changed
+// channel (may be nil) triggers the checks between the periodic ones
+func watchStatus(ctx context.Context, status func() ServiceStatus, changed <-chan struct{}) <-chan StatusEvent {
+	events := make(chan StatusEvent)
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		previous := status()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case _, ok := <-changed:
+				if !ok {
+					changed = nil
+				}
+			}
+
+			current := status()
+			if event, ok := statusEvent(previous, current); ok {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+
+	return events
+}